@@ -53,40 +53,40 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/http/fcgi"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/xeipuuv/gojsonschema"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-type QueryResponse struct {
-	query    string
-	response string
-}
-
-// Request Response map
-type RequestResponseMap map[string]QueryResponse
-
 // helper for HTTP handler queries
 type customHandler struct {
 	cmux        http.Handler
-	rrmap       *RequestResponseMap
-	reqJS       *gojsonschema.JSONLoader
+	rrmap       FixtureStore
+	reqSchema   *gojsonschema.Schema
 	forcedDebug bool
+	upstream    *upstreamHandler
+	shadow      *shadowDiff
+	passThrough []*upstreamHandler
 }
 
 // Expected data Dir
@@ -101,184 +101,399 @@ var ResponseJsonSchemaFile = "responseJsonSchema.json"
 // MockRequestResponseFile global var due to lazyness
 var MockRequestResponseFile = "requestResponseMap.json"
 
+// MockJsonSchema to validate the own mock input
+var MockJsonSchema = `{ 
+		"$schema": "http://json-schema.org/draft-07/schema#",
+  		"title": "Mock Request Response Json Schema",
+  		"description": "version 0.0.1",
+    	"type": "array",
+    	"items": {
+    		"type": "object",
+    		"properties": {
+      			"req": {
+        			"type": "object"
+      			},
+      			"res": {
+        			"type": "object"
+      		   },
+               "query": {
+                    "type": "string"
+               },
+               "schemas": {
+                    "type": "object",
+                    "properties": {
+                         "req": { "type": "string" },
+                         "res": { "type": "string" }
+                    },
+                    "additionalProperties": false
+               }
+             },
+    		"anyOf": [
+      			{ "required": [ "req", "res" ] },
+      			{ "required": [ "schemas" ] }
+    		]
+  		}
+	}`
+
 // DebugParameter global var due to lazyness
 var DebugParameter = "debug"
 var ForcedDebug = false
 
-func main() {
-
-	host, port, mockRequestResponseFile, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug := cmdLine()
-	log.Printf("Launched "+os.Args[0]+" -host="+host+" -port="+port+" -map="+mockRequestResponseFile+
-		" -req="+requestJsonSchemaFile+" -res="+responseJsonSchemaFile+" -debug=%t", forcedDebug)
+// LogFile logs are appended to, empty for stderr
+var LogFile = ""
 
-	reqresmap, reqJS, err := validateMockRequestResponseFile(mockRequestResponseFile, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug)
-	if err != nil {
-		log.Fatal(err)
-	}
-	log.Printf("Number of fake request/response: %d", len(reqresmap))
+// Latency before answering from fixtures, plus a random LatencyJitter up to that one
+var Latency time.Duration
+var LatencyJitter time.Duration
 
-	mux := mux.NewRouter()
-	// bind cmux to mx(route) and rrmap to reqresmap
-	fcgiHandler := &customHandler{cmux: mux, rrmap: &reqresmap, reqJS: &reqJS, forcedDebug: forcedDebug}
-	mux.Path("/").Handler(fcgiHandler)
+func main() {
 
-	listener, _ := net.Listen("tcp", host+":"+port) // see nginx.conf
-	if err := fcgi.Serve(listener, fcgiHandler); err != nil {
-		log.Fatal(err)
+	// only flags, as it has always been, means serve
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || name == "/?" {
+		os.Exit(helpCommand(args))
 	}
+	command := findSubcommand(name)
+	if command == nil {
+		fmt.Fprintln(os.Stderr, "Unknown command "+name)
+		printSubcommands(os.Stderr)
+		os.Exit(2)
+	}
+	os.Exit(command.run(args))
 }
 
-// get command line parameters
-func cmdLine() (string, string, string, string, string, bool) {
-
-	hostArg := "0.0.0.0"
-	portArg := "9797"
-	mockRequestResponseFile := filepath.Dir(os.Args[0]) + filepath.FromSlash("/") + DataDir + filepath.FromSlash("/") + MockRequestResponseFile
-	requestJsonSchemaFile := filepath.Dir(os.Args[0]) + filepath.FromSlash("/") + DataDir + filepath.FromSlash("/") + RequestJsonSchemaFile
-	responseJsonSchemaFile := filepath.Dir(os.Args[0]) + filepath.FromSlash("/") + DataDir + filepath.FromSlash("/") + ResponseJsonSchemaFile
-	forcedDebug := ForcedDebug
+// serves the fixtures: JsonMock [serve] -map=... -req=... -res=...
+func serveCommand(args []string) int {
 
-	cmd := strings.Join(os.Args, " ")
-	if strings.Contains(cmd, " help") || strings.Contains(cmd, " -help") || strings.Contains(cmd, " --help") ||
-		strings.Contains(cmd, " -h") || strings.Contains(cmd, " /?") {
-		fmt.Println()
-		fmt.Println("Usage: " + os.Args[0] + " -host=<host> -port=<port> -map=<MockRequestResponseFile> -req=<RequestJsonSchema> -res=<ResponseJsonSchema> -debug=<ForcedDebug>")
-		fmt.Println()
-		fmt.Println("host:  Host name for this FastCGI process.   By default " + hostArg)
-		fmt.Println("port:  Port number for this FastCGI process. By default " + portArg)
-		fmt.Println()
-		fmt.Println("map: Fake mapped request/response file. By default " + mockRequestResponseFile)
-		fmt.Println("req: Json Schema to validate requests.  By default " + requestJsonSchemaFile)
-		fmt.Println("res: Json Schema to validate responses. By default " + responseJsonSchemaFile)
-		fmt.Println()
-		fmt.Printf("debug:  Flag to force debug mode. By default %b\n", forcedDebug)
-		fmt.Println()
-		fmt.Println("Being a FastCGI, don't forget to properly configure NGINX.")
-		fmt.Println()
-		os.Exit(0)
+	config := defaultConfig()
+	flags := serverFlags("serve", config)
+	if err := loadConfig(flags, config, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
 	}
-
-	flag.StringVar(&hostArg, "host", hostArg, "Host name for this FastCGI process.")
-	flag.StringVar(&portArg, "port", portArg, "Port name for this FastCGI process.")
-	flag.StringVar(&mockRequestResponseFile, "map", mockRequestResponseFile, "Fake mapped request/response file.")
-	flag.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Json Schema to validate requests.")
-	flag.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Json Schema to validate responses.")
-	flag.BoolVar(&forcedDebug, "debug", forcedDebug, "Flag to force debug mode.")
-	flag.Parse()
-
-	return hostArg, portArg, mockRequestResponseFile, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug
+	return runServer(config)
 }
 
-// validate fake request response map against their json schemas
-func validateMockRequestResponseFile(mockRequestResponseFile string, requestJsonSchemaFile string, responseJsonSchemaFile string, debug bool) (RequestResponseMap, gojsonschema.JSONLoader, error) {
+// until the server fails, whatever mode the settings ask for
+func runServer(config *Config) int {
 
-	// regexpr to detect 'debug' params
-	var debugRegexp = regexp.MustCompile("^" + DebugParameter + "")
+	if len(LogFile) > 0 {
+		out, err := os.OpenFile(LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.SetOutput(out)
+	}
+	host, port, mockRequestResponseFiles, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug := config.Host, config.Port, config.Map.files, config.Req, config.Res, config.Debug
+	log.Printf("Launched "+os.Args[0]+" -config="+ConfigFile+" -host="+host+" -port="+port+" -map="+strings.Join(mockRequestResponseFiles, ",")+
+		" -req="+requestJsonSchemaFile+" -res="+responseJsonSchemaFile+" -debug=%t", forcedDebug)
+
+	var reqresmap FixtureStore
+	var reqSchema *gojsonschema.Schema
+	var upstream *upstreamHandler
 	var err error
-	var reqresmap RequestResponseMap = make(map[string]QueryResponse)
-	var reqJsonSchema gojsonschema.JSONLoader
+	if err = setResponseEncodings(ResponseEncodings); err != nil {
+		log.Fatal(err)
+	}
+	if len(ServicesFile) > 0 || len(config.Services) > 0 {
+		// several mock services instead of a single one
+		if len(RecordUpstream) > 0 || len(ProxyUpstream) > 0 {
+			log.Fatal("Use either -services or -record and -proxy, not both")
+		}
+		if err := checkServicesFlags(config); err != nil {
+			log.Fatal(err)
+		}
+		var services []*mockService
+		if len(ServicesFile) > 0 {
+			services, err = loadServices(ServicesFile, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug, config.RecordMap)
+		} else {
+			// listed at the config file itself
+			services, err = loadServiceConfigs(ConfigFile, config.Services, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug, config.RecordMap)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		tlsConfig, err := serverTLSConfig(host, config.TLSAutoCA)
+		if err != nil {
+			log.Fatal(err)
+		}
+		address := host + ":" + port
+		if len(Listen) > 0 {
+			address = Listen
+		}
+		log.Println(serveServices(services, address, tlsConfig))
+		return 1
+	}
+	if len(RecordUpstream) > 0 && len(ProxyUpstream) > 0 {
+		log.Fatal("Use either -record or -proxy, not both")
+	}
+	if len(RecordUpstream) > 0 || len(ProxyUpstream) > 0 {
+		// no fixtures needed, the real backend answers
+		upstream, err = newUpstreamHandler(RecordUpstream+ProxyUpstream, requestJsonSchemaFile, responseJsonSchemaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		upstream.strict = ProxyStrict
+		if len(RecordUpstream) > 0 {
+			log.Println("Recording " + RecordUpstream + " into " + config.RecordMap)
+			if upstream.recorder, err = newRecorder(config.RecordMap); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			log.Printf("Validating proxy to "+ProxyUpstream+" -proxyStrict=%t", ProxyStrict)
+		}
+	} else if len(IndexFile) > 0 {
+		// prebuilt index: nothing to load nor validate at startup
+		reqresmap, err = openDiskStore(IndexFile, IndexCacheEntries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		reqSchema, err = loadSchemaFile(requestJsonSchemaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Number of fake request/response: %d at %s -cache=%d", reqresmap.Len(), IndexFile, IndexCacheEntries)
+	} else {
+		reqresmap, reqSchema, err = loadMockRequestResponseFiles(mockRequestResponseFiles, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug)
+		if _, broken := err.(*mockFileError); broken || (err != nil && len(OpenApiFile) == 0) {
+			log.Fatal(err)
+		} else if err != nil {
+			// fixtures might come from the OpenAPI examples only
+			log.Println(err)
+		}
+		log.Printf("Number of fake request/response: %d", reqresmap.Len())
+	}
 
-	mock, err := validateMockInput(mockRequestResponseFile)
-	if err != nil {
-		return reqresmap, reqJsonSchema, err
+	mux := mux.NewRouter()
+	// bind cmux to mx(route) and rrmap to reqresmap
+	fcgiHandler := &customHandler{cmux: mux, rrmap: reqresmap, reqSchema: reqSchema, forcedDebug: forcedDebug, upstream: upstream}
+	if len(DiffUpstream) > 0 && upstream == nil {
+		log.Println("Comparing fixtures with " + DiffUpstream + ", see " + AdminPrefix + "/diff")
+		fcgiHandler.shadow = newShadowDiff(DiffUpstream)
+		mux.Path(AdminPrefix + "/diff").Handler(fcgiHandler.shadow)
+	}
+	if upstream == nil {
+		if fcgiHandler.passThrough, err = passThroughFromFlags(config.RecordMap); err != nil {
+			log.Fatal(err)
+		}
+	}
+	openApiFile := OpenApiFile
+	if upstream != nil {
+		openApiFile = ""
+	}
+	if err = routeMockService(mux, fcgiHandler, reqresmap, openApiFile, forcedDebug); err != nil {
+		log.Fatal(err)
 	}
 
-	req, err := ioutil.ReadFile(requestJsonSchemaFile)
+	tlsConfig, err := serverTLSConfig(host, config.TLSAutoCA)
 	if err != nil {
 		log.Fatal(err)
-		return reqresmap, reqJsonSchema, errors.New("Unable to read Request Json Schema File.")
 	}
 
-	res, err := ioutil.ReadFile(responseJsonSchemaFile)
+	address := host + ":" + port // see nginx.conf
+	if len(Listen) > 0 {
+		address = Listen
+	}
+	listener, err := listen(address)
 	if err != nil {
 		log.Fatal(err)
-		return reqresmap, reqJsonSchema, errors.New("Unable to read Response Json Schema File.")
 	}
+	log.Println(serve(listener, mux, tlsConfig))
+	return 1
+}
 
-	reqJsonSchema = gojsonschema.NewStringLoader(string(req))
-	resJsonSchema := gojsonschema.NewStringLoader(string(res))
+// OpenAPI operations, if any, and whatever the location NGINX passes on, all answered by the same fixtures
+func routeMockService(router *mux.Router, handler *customHandler, reqresmap FixtureStore, openApiFile string, debug bool) error {
 
-	type ReqRes struct {
-		Qry      string           `json:"query,omitempty"`
-		Req      *json.RawMessage `json:"req"`
-		Res      *json.RawMessage `json:"res"`
-		request  string
-		response string
+	if len(openApiFile) > 0 {
+		routes, err := loadOpenApiRoutes(openApiFile, debug)
+		if err != nil {
+			return err
+		}
+		allowed := make(map[string][]string)
+		for _, route := range routes {
+			allowed[route.path] = append(allowed[route.path], route.method)
+			// mapping files fixtures win over the examples
+			operation := *handler
+			operation.rrmap = storeChain{reqresmap, route.fixtures}
+			operation.reqSchema = route.reqSchema
+			router.Path(route.path).Methods(route.method).Handler(&operation)
+			log.Printf("OpenAPI: %s %s with %d examples", route.method, route.path, route.fixtures.Len())
+		}
+		for path, methods := range allowed {
+			router.Path(path).Handler(methodNotAllowed(methods))
+		}
 	}
-	dec := json.NewDecoder(strings.NewReader(string(mock)))
+	router.PathPrefix("/").Handler(handler)
+	return nil
+}
 
-	err = ignoreFirstBracket(dec)
-	if err != nil {
-		return reqresmap, reqJsonSchema, err
+// FastCGI, plain HTTP, h2c or HTTPS as told by the flags, until the listener fails
+func serve(listener net.Listener, handler http.Handler, tlsConfig *tls.Config) error {
+
+	log.Println("Listening at " + listener.Addr().Network() + ":" + listener.Addr().String())
+	switch {
+	case tlsConfig != nil:
+		// HTTP/2 negotiated by ALPN, HTTP/1.1 otherwise
+		log.Printf("Serving HTTPS, HTTP/2 and HTTP/1.1, client certificates required=%t", tlsConfig.ClientCAs != nil)
+		server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+		if err := http2.ConfigureServer(server, &http2.Server{}); err != nil {
+			return err
+		}
+		return server.ServeTLS(listener, "", "")
+	case Protocol == "h2c":
+		// prior knowledge and Upgrade: h2c, HTTP/1.1 otherwise
+		log.Println("Serving cleartext HTTP/2 and HTTP/1.1")
+		return http.Serve(listener, h2c.NewHandler(handler, &http2.Server{}))
+	case Protocol == "http":
+		log.Println("Serving plain HTTP/1.1")
+		return http.Serve(listener, handler)
+	default:
+		return fcgi.Serve(listener, handler)
 	}
+}
 
-	// read object {"req": string, "res": string}
-	for dec.More() {
-		var rr ReqRes
-		err = dec.Decode(&rr)
-		if err != nil {
-			log.Fatal(err)
-			return reqresmap, reqJsonSchema, errors.New("Unable to process object at Mock Request Response File")
+// every server flag, bound to config and the globals; its usage lists them all
+func serverFlags(name string, config *Config) *flag.FlagSet {
+
+	flags := commandFlags(name)
+	flags.StringVar(&ConfigFile, "config", ConfigFile, "Yaml, json or toml file with these settings. Flags win over JSONMOCK_<FLAG> env vars, which win over it.")
+	flags.StringVar(&config.Host, "host", config.Host, "Host name for this FastCGI process.")
+	flags.StringVar(&config.Port, "port", config.Port, "Port number for this FastCGI process.")
+	flags.Var(&config.Map, "map", "Fake mapped request/response file, directory or glob. Can be repeated.")
+	flags.StringVar(&config.Req, "req", config.Req, "Json Schema to validate requests.")
+	flags.StringVar(&config.Res, "res", config.Res, "Json Schema to validate responses.")
+	flags.BoolVar(&config.Debug, "debug", config.Debug, "Flag to force debug mode.")
+	flags.StringVar(&DebugParameter, "debug-param", DebugParameter, "Query parameter turning debug mode on for a request, never taken into account to match fixtures.")
+	flags.StringVar(&LogFile, "log-file", LogFile, "File the logs are appended to. By default stderr.")
+	flags.DurationVar(&Latency, "latency", Latency, "Delay before answering from fixtures, like 50ms.")
+	flags.DurationVar(&LatencyJitter, "latency-jitter", LatencyJitter, "Random delay up to this one added to -latency.")
+	flags.StringVar(&RecordUpstream, "record", RecordUpstream, "Real backend URL to forward every request to, recording its answers.")
+	flags.StringVar(&config.RecordMap, "recordMap", config.RecordMap, "Mapping file where recorded entries are appended.")
+	flags.StringVar(&ProxyUpstream, "proxy", ProxyUpstream, "Real backend URL to forward every request to, validating both sides.")
+	flags.BoolVar(&ProxyStrict, "proxyStrict", ProxyStrict, "Answer 502 when the real backend breaks its Json Schema.")
+	flags.StringVar(&DiffUpstream, "diff", DiffUpstream, "Real backend URL to compare fixtures with, in background. Drifts at "+AdminPrefix+"/diff.")
+	flags.Var(&PassThrough, "passThrough", "[<path prefix>=]<url> where requests without fixture are forwarded. Can be repeated.")
+	flags.BoolVar(&PassThroughRecord, "passThroughRecord", PassThroughRecord, "Append pass-through answers to recordMap.")
+	flags.StringVar(&OpenApiFile, "openapi", OpenApiFile, "OpenAPI 3 document, json or yaml, routing by path and method with its schemas and examples.")
+	flags.StringVar(&ServicesFile, "services", ServicesFile, "Json or yaml file of named mock services, each with its own fixtures, schemas, routing and debug flag.")
+	flags.IntVar(&LoadProgressEntries, "progress", LoadProgressEntries, "Mapping file entries loaded between progress logs. 0 for none.")
+	flags.StringVar(&IndexFile, "index", IndexFile, "Index built by 'JsonMock index' to look fixtures up on disk, instead of -map.")
+	flags.StringVar(&ResponseEncodings, "compress", ResponseEncodings, "Compressed variants of every response kept since loaded, by preference: gzip, br. None by default.")
+	flags.IntVar(&IndexCacheEntries, "cache", IndexCacheEntries, "Fixtures of -index kept in memory, least recently used dropped first.")
+	flags.StringVar(&Listen, "listen", Listen, "unix:<path> to listen at a unix domain socket, or [tcp:]<host>:<port>. By default -host and -port.")
+	flags.StringVar(&ListenMode, "listen-mode", ListenMode, "Octal permissions of the -listen unix domain socket.")
+	flags.StringVar(&Protocol, "protocol", Protocol, "Either fcgi, behind NGINX, plain http or h2c, plain http plus cleartext HTTP/2. Implied http with TLS.")
+	flags.StringVar(&TLSCertFile, "tls-cert", TLSCertFile, "Server certificate, PEM encoded, to serve HTTPS.")
+	flags.StringVar(&TLSKeyFile, "tls-key", TLSKeyFile, "Key of -tls-cert, PEM encoded.")
+	flags.BoolVar(&TLSAuto, "tls-auto", TLSAuto, "Serve HTTPS with a self-signed certificate made up at startup.")
+	flags.StringVar(&config.TLSAutoCA, "tls-auto-ca", config.TLSAutoCA, "CA of -tls-auto for clients to trust, made up when missing. Its key and a client certificate are left next to it.")
+	flags.StringVar(&TLSClientCAFile, "tls-client-ca", TLSClientCAFile, "CA every client certificate must be signed by, for mutual TLS.")
+	flags.StringVar(&TLSClientParam, "tls-client-param", TLSClientParam, "Query parameter taking the Common Name of the client certificate, to be matched by fixtures.")
+
+	usage := flags.Usage
+	flags.Usage = func() {
+		usage()
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Being a FastCGI, don't forget to properly configure NGINX.")
+	}
+	return flags
+}
+
+// default location of data files, next to the binary
+func dataFilePath(file string) string {
+	return filepath.Dir(os.Args[0]) + filepath.FromSlash("/") + DataDir + filepath.FromSlash("/") + file
+}
+
+// validate fake request response map against their json schemas, telling the request schema file applied
+func validateMockRequestResponseFile(mockRequestResponseFile string, requestJsonSchemaFile string, responseJsonSchemaFile string, debug bool) (*RequestResponseMap, string, error) {
+
+	reqresmap := newRequestResponseMap(0)
+	requestJsonSchemaFile, err := forEachValidFixture(mockRequestResponseFile, requestJsonSchemaFile, responseJsonSchemaFile, debug, reqresmap.Add)
+	return reqresmap, requestJsonSchemaFile, err
+}
+
+// every fixture of a mapping file complying with its schemas, compacted and keyed; add tells whether its key was new.
+// The request schema file applied, its own one if declared, is returned
+func forEachValidFixture(mockRequestResponseFile string, requestJsonSchemaFile string, responseJsonSchemaFile string, debug bool, add func(key string, value QueryResponse) bool) (string, error) {
+
+	var reqJsonSchema, resJsonSchema *gojsonschema.Schema
+
+	// schemas are loaded once the header, if any, has been read
+	header := func(schemas *MockSchemas) error {
+
+		// this file might declare its own schemas
+		if schemas != nil {
+			requestJsonSchemaFile, responseJsonSchemaFile = mockSchemaFiles(mockRequestResponseFile, schemas, requestJsonSchemaFile, responseJsonSchemaFile)
+			if debug {
+				log.Println("Schemas declared at " + mockRequestResponseFile + ": -req=" + requestJsonSchemaFile + " -res=" + responseJsonSchemaFile)
+			}
 		}
 
-		rr.request, err = toString(rr.Req)
+		var err error
+		reqJsonSchema, err = loadSchemaFile(requestJsonSchemaFile)
 		if err != nil {
-			log.Println("Unable to process request object at Mock Request Response File")
-			continue
+			log.Println(err)
+			return errors.New("Unable to read Request Json Schema File.")
 		}
 
-		rr.response, err = toString(rr.Res)
+		resJsonSchema, err = loadSchemaFile(responseJsonSchemaFile)
 		if err != nil {
-			log.Println("Unable to process response object at Mock Request Response File")
-			continue
+			log.Println(err)
+			return errors.New("Unable to read Response Json Schema File.")
 		}
+		return nil
+	}
+
+	err := forEachMockEntry(mockRequestResponseFile, header, func(query string, request string, response string) {
 
-		rr.Qry = orderQueryByParams(rr.Qry, debugRegexp)
 		if debug {
-			if len(rr.Qry) > 0 {
-				log.Printf("%v %v -> %v\n", rr.Qry, rr.request, rr.response)
+			if len(query) > 0 {
+				log.Printf("%v %v -> %v\n", query, request, response)
 			} else {
-				log.Printf(" %v -> %v\n", rr.request, rr.response)
+				log.Printf(" %v -> %v\n", request, response)
 			}
 		}
 
-		if !validateRequest(reqJsonSchema, rr.request) {
-			continue
+		if !validateRequest(reqJsonSchema, request) {
+			return
 		}
-		if !validateResponse(resJsonSchema, rr.response) {
-			continue
+		if !validateResponse(resJsonSchema, response) {
+			return
 		}
 
 		// add pair to the map but after compacting those json
-		key, err := compactJson([]byte(rr.request))
+		key, err := compactJson([]byte(request))
 		if err != nil {
 			log.Println("This request will be ignored")
-			continue
-		}
-		if len(rr.Qry) > 0 {
-			// key must take into account as well the provided query
-			key = "[" + rr.Qry + "]" + key
+			return
 		}
-		response, err := compactJson([]byte(rr.response))
+		// key must take into account as well the provided query
+		key = mapKey(query, key)
+		compacted, err := compactJson([]byte(response))
 		if err != nil {
 			log.Println("That response will be ignored")
-			continue
+			return
 		}
-		var value QueryResponse
-		value.response = response
-		reqresmap[key] = value
-	}
+		if !add(key, QueryResponse{query: query, response: compacted}) {
+			log.Println("Duplicated key " + key + " at " + mockRequestResponseFile + ". Only the first one will be used")
+		}
+	})
+	return requestJsonSchemaFile, err
+}
 
-	err = ignoreLastBracket(dec)
-	if err != nil {
-		return reqresmap, reqJsonSchema, err
-	}
+// request of the mapped fixtures answering requests without body
+const emptyRequest = "{}"
 
-	// return result
-	if len(reqresmap) == 0 {
-		err = errors.New("Unable to validate any entry at Mock Request Response File")
+// key at the map: ordered query between brackets, if any, followed by the compacted request
+func mapKey(query string, request string) string {
+	if len(query) > 0 {
+		return "[" + query + "]" + request
 	}
-	return reqresmap, reqJsonSchema, err
+	return request
 }
 
 // convert into an string
@@ -332,124 +547,206 @@ func compactJson(loose []byte) (string, error) {
 	return compactedBuffer.String(), nil
 }
 
-// validation request
-func validateRequest(reqJsonSchema gojsonschema.JSONLoader, rrReq string) bool {
+// entry of a mapping file as read by the loader
+type mockEntryRead struct {
+	index   int
+	rr      ReqResEntry
+	invalid []gojsonschema.ResultError // against the mock Json Schema, which makes the whole file refused
+}
+
+// entry of a mapping file that can't be read, nor any other after it
+type mockEntryError struct {
+	entry int
+	err   error
+}
+
+func (e *mockEntryError) Error() string {
+	return fmt.Sprintf("Unable to process entry %d at Mock Request Response File: %v", e.entry, e.err)
+}
+
+// read every entry of a mapping file one by one, checked against the mock Json Schema; loading and validating share it, so they never disagree
+func walkMockEntries(mockRequestResponseFile string, visit func(read *mockEntryRead) error) error {
 
-	result, err := gojsonschema.Validate(reqJsonSchema, gojsonschema.NewStringLoader(rrReq))
+	reader, err := openMockEntries(mockRequestResponseFile)
 	if err != nil {
-		log.Fatal(err)
-		log.Println("This request will be ignored")
-		return false
+		return errors.New("Unable to read Mock Request Response File: " + err.Error())
 	}
-	if !result.Valid() {
-		log.Println("Request is not valid. See errors: ")
-		for _, desc := range result.Errors() {
-			log.Printf("- %s\n", desc)
+	defer reader.Close()
+
+	entry := 0
+	for ; ; entry++ {
+		raw, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &mockEntryError{entry: entry, err: err}
+		}
+
+		read := &mockEntryRead{index: entry}
+		result, err := mockEntrySchema.Validate(gojsonschema.NewBytesLoader(raw))
+		if err != nil {
+			return errors.New("Unable to process mock Json Schema: " + err.Error())
+		}
+		if !result.Valid() {
+			read.invalid = result.Errors()
+		} else if err = json.Unmarshal(raw, &read.rr); err != nil {
+			return &mockEntryError{entry: entry, err: err}
+		}
+		if err = visit(read); err != nil {
+			return err
+		}
+
+		if LoadProgressEntries > 0 && (entry+1)%LoadProgressEntries == 0 {
+			log.Printf("%s: %d entries, %s\n", mockRequestResponseFile, entry+1, reader.progress())
 		}
-		log.Println("That request will be ignored")
-		return false
 	}
-	return true
+	if LoadProgressEntries > 0 && entry >= LoadProgressEntries {
+		log.Printf("%s: %d entries, %s\n", mockRequestResponseFile, entry, reader.progress())
+	}
+	return nil
 }
 
-// validation response
-func validateResponse(resJsonSchema gojsonschema.JSONLoader, rrRes string) bool {
-
-	result, err := gojsonschema.Validate(resJsonSchema, gojsonschema.NewStringLoader(rrRes))
+// query, request and response of an entry, as they are keyed and answered
+func mockFixture(rr *ReqResEntry, debugRegexp *regexp.Regexp) (string, string, string, error) {
+	request, err := toString(rr.Req)
 	if err != nil {
-		log.Fatal(err)
-		log.Println("This response will be ignored")
-		return false
+		return "", "", "", errors.New("Unable to process request object at Mock Request Response File")
 	}
-	if !result.Valid() {
-		log.Println("Response is not valid. See errors: ")
-		for _, desc := range result.Errors() {
-			log.Printf("- %s\n", desc)
-		}
-		log.Println("That response will be ignored")
-		return false
+	response, err := toString(rr.Res)
+	if err != nil {
+		return "", "", "", errors.New("Unable to process response object at Mock Request Response File")
 	}
-
-	return true
+	return orderQueryByParams(rr.Qry, debugRegexp), request, response, nil
 }
 
-// ignore first bracket when json mock Request Response file is decoded
-func ignoreFirstBracket(dec *json.Decoder) error {
-	_, err := dec.Token()
-	if err != nil {
-		log.Fatal(err)
-		return errors.New("Unable to process first token at Mock Request Response File")
+// schemas of a mapping file: those its header declares, relative to it, or the given ones
+func mockSchemaFiles(mockRequestResponseFile string, schemas *MockSchemas, requestJsonSchemaFile string, responseJsonSchemaFile string) (string, string) {
+	if schemas != nil {
+		if len(schemas.Req) > 0 {
+			requestJsonSchemaFile = relativeToFile(mockRequestResponseFile, schemas.Req)
+		}
+		if len(schemas.Res) > 0 {
+			responseJsonSchemaFile = relativeToFile(mockRequestResponseFile, schemas.Res)
+		}
 	}
-	return nil
+	return requestJsonSchemaFile, responseJsonSchemaFile
 }
 
-// ignore last bracket when json mock Request Response file is decoded
-func ignoreLastBracket(dec *json.Decoder) error {
-	_, err := dec.Token()
+// stream every request/response pair of a mapping file, validated one by one, schemas header apart
+func forEachMockEntry(mockRequestResponseFile string, header func(schemas *MockSchemas) error, process func(query string, request string, response string)) error {
+
+	// regexpr to detect 'debug' params
+	var debugRegexp = regexp.MustCompile("^" + DebugParameter + "")
+
+	// the header, if any, is only known when the first entry is read
+	headerDone := false
+	doHeader := func(schemas *MockSchemas) error {
+		headerDone = true
+		if header == nil {
+			return nil
+		}
+		return header(schemas)
+	}
+
+	err := walkMockEntries(mockRequestResponseFile, func(read *mockEntryRead) error {
+
+		if len(read.invalid) > 0 {
+			log.Printf("Mock Request Response File is not valid at entry %d. See errors: \n", read.index)
+			for _, desc := range read.invalid {
+				log.Printf("- %s\n", desc)
+			}
+			return errors.New("Invalid Mock Request Response File")
+		}
+
+		if read.rr.Schemas != nil {
+			if read.index > 0 {
+				log.Printf("Schemas header at entry %d of %s will be ignored: only allowed as first entry\n", read.index, mockRequestResponseFile)
+				return nil
+			}
+			return doHeader(read.rr.Schemas)
+		}
+		if !headerDone {
+			if err := doHeader(nil); err != nil {
+				return err
+			}
+		}
+
+		query, request, response, err := mockFixture(&read.rr, debugRegexp)
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		process(query, request, response)
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
-		return errors.New("Unable to process last token at Mock Request Response File")
+		return err
+	}
+
+	if !headerDone {
+		return doHeader(nil)
 	}
 	return nil
 }
 
-// validate just mock input
-func validateMockInput(mockRequestResponseFile string) ([]byte, error) {
+// validation request
+func validateRequest(reqJsonSchema *gojsonschema.Schema, rrReq string) bool {
 
-	mock, err := ioutil.ReadFile(mockRequestResponseFile)
+	result, err := reqJsonSchema.Validate(gojsonschema.NewStringLoader(rrReq))
 	if err != nil {
-		log.Fatal(err)
-		return mock, errors.New("Unable to read Mock Request Response File.")
+		// not even json, it must not stop the server
+		log.Println(err)
+		log.Println("This request will be ignored")
+		return false
 	}
+	if !result.Valid() {
+		log.Println("Request is not valid. See errors: ")
+		for _, desc := range result.Errors() {
+			log.Printf("- %s\n", desc)
+		}
+		log.Println("That request will be ignored")
+		return false
+	}
+	return true
+}
 
-	// validate the own mock input
-	mockJsonSchema := gojsonschema.NewStringLoader(`{ 
-		"$schema": "http://json-schema.org/draft-04/schema#",
-  		"title": "Mock Request Response Json Schema",
-  		"description": "version 0.0.1",
-    	"type": "array",
-    	"items": {
-    		"type": "object",
-    		"properties": {
-      			"req": {
-        			"type": "object"
-      			},
-      			"res": {
-        			"type": "object"
-      		   },
-               "query": {
-                    "type": "string"
-               }
-             },
-    		"required": [
-      			"req",
-      			"res"
-    		]
-  		}
-	}`)
+// validation response
+func validateResponse(resJsonSchema *gojsonschema.Schema, rrRes string) bool {
 
-	result, err := gojsonschema.Validate(mockJsonSchema, gojsonschema.NewStringLoader(string(mock)))
+	result, err := resJsonSchema.Validate(gojsonschema.NewStringLoader(rrRes))
 	if err != nil {
-		log.Fatal(err)
-		return mock, errors.New("Unable to process mock Json Schema")
+		log.Println(err)
+		log.Println("This response will be ignored")
+		return false
 	}
 	if !result.Valid() {
-		log.Println("Mock Request Response File is not valid. See errors: ")
+		log.Println("Response is not valid. See errors: ")
 		for _, desc := range result.Errors() {
 			log.Printf("- %s\n", desc)
 		}
-		return mock, errors.New("Invalid Mock Request Response File")
+		log.Println("That response will be ignored")
+		return false
 	}
 
-	// success
-	return mock, nil
+	return true
 }
 
 // must have at least ServeHTTP(), otherwise you will get this error
 // *customHandler does not implement http.Handler (missing ServeHTTP method)
 func (c *customHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	debug := (r.URL.Query()[DebugParameter] != nil) || c.forcedDebug
+	// GET params parsed just once
+	values := r.URL.Query()
+	debug := (values[DebugParameter] != nil) || c.forcedDebug
+
+	// who the client is, as told by its certificate and never by the client itself
+	if len(TLSClientParam) > 0 {
+		values.Del(TLSClientParam)
+		if name := clientCommonName(r); len(name) > 0 {
+			values.Set(TLSClientParam, name)
+		}
+	}
 
 	if r.Method == http.MethodHead {
 		if debug {
@@ -461,66 +758,80 @@ func (c *customHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// GET params as a string
-	query := QueryAsString(r)
+	query := QueryValuesAsString(values)
 	if debug {
 		log.Println(query)
 	}
 
-	if r.ContentLength > 0 {
+	// proxy and record modes: the real backend answers
+	if c.upstream != nil {
+		c.upstream.ServeHTTP(w, r, query, debug)
+		return
+	}
 
-		// get body request to process
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
+	simulateLatency()
+
+	// unknown length (-1) as well: plain HTTP clients might send it chunked
+	if r.ContentLength != 0 {
+
+		// get body request to process, into a reused buffer
+		buffer := getBuffer()
+		defer putBuffer(buffer)
+		if _, err := buffer.ReadFrom(r.Body); err != nil {
 			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			if debug {
 				log.Println(err)
 			}
+			return
 		}
+		body := buffer.Bytes()
 
 		if debug {
 			log.Println("Body received: " + string(body))
 		}
 
 		// avoid processing before having booted up completely
-		if c.rrmap != nil && len(*c.rrmap) > 0 {
+		if c.rrmap.Len() > 0 {
 
-			// really not needed, no invalid request in our map, but it's good to provide some feedback to our logs
-			if validateRequest(*c.reqJS, string(body)) {
+			compacted := getBuffer()
+			defer putBuffer(compacted)
+			if err := json.Compact(compacted, body); err != nil && debug {
+				log.Print(err)
+			}
 
-				key, err := compactJson(body)
-				if err != nil {
-					if debug {
-						log.Print(err)
-					}
+			// fixtures were validated when loaded, so only unknown requests need to be checked
+			if entry := c.rrmap.lookup(query, compacted.Bytes()); entry != nil {
+				writeFixture(w, r, entry, debug)
+				// diff mode: does the real backend still agree?
+				if c.shadow != nil {
+					c.shadow.compare(r, entry.key, query, append([]byte(nil), body...), string(entry.response), debug)
 				}
-				if len(query) > 0 {
-					key = "[" + query + "]" + key
+			} else if !validateRequest(c.reqSchema, string(body)) {
+				if !c.forwardUnmatched(w, r, query, body, debug) {
+					http.Error(w, "Body Json Request doesn't comply with its expected Json Schema", http.StatusUnprocessableEntity)
 				}
-				value := (*c.rrmap)[key]
-				if len(value.response) > 0 {
-					w.Header().Set("Content-Lenghth", strconv.Itoa(len(value.response)))
-					w.Header().Set("Content-Type", "application/json")
-					if _, err := w.Write([]byte(value.response)); err != nil {
-						http.Error(w, err.Error(), http.StatusUnprocessableEntity)
-						if debug {
-							log.Println(err)
-						}
-					}
-					if debug {
-						log.Println("Sent back: " + value.response)
-					}
-				} else {
-					http.Error(w, "key not found at internal cache", http.StatusNoContent)
-					if debug {
-						log.Println("key not found at internal cache")
-					}
+			} else if c.forwardUnmatched(w, r, query, body, debug) {
+				if debug {
+					log.Println("key not found at internal cache, passed through")
 				}
-
 			} else {
-				http.Error(w, "Body Json Request doesn't comply with its expected Json Schema", http.StatusUnprocessableEntity)
+				http.Error(w, "key not found at internal cache", http.StatusNoContent)
+				if debug {
+					log.Println("key not found at internal cache")
+				}
 			}
 		}
 
+	} else if entry := c.rrmap.lookup(query, nil); entry != nil {
+		// operations without body, only known by their query
+		writeFixture(w, r, entry, debug)
+	} else if entry := c.rrmap.lookup(query, []byte(emptyRequest)); entry != nil {
+		// mapping files tell them by an empty request
+		writeFixture(w, r, entry, debug)
+	} else if c.forwardUnmatched(w, r, query, nil, debug) {
+		if debug {
+			log.Println("empty request body received, passed through")
+		}
 	} else {
 		http.Error(w, "empty request body received", http.StatusNoContent)
 		if debug {
@@ -533,37 +844,75 @@ func (c *customHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// fake answers take as long as -latency, plus up to -latency-jitter
+func simulateLatency() {
+	delay := Latency
+	if LatencyJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(LatencyJitter)))
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// pre-serialized answer, headers included
+func writeFixture(w http.ResponseWriter, r *http.Request, entry *fixtureEntry, debug bool) {
+	header := w.Header()
+	body, length := entry.response, entry.length
+	// every answer might be compressed, so caches keep them apart even when this one has no variant
+	if len(responseEncodings) > 0 {
+		header["Vary"] = varyAcceptEncoding
+	}
+	// already compressed, as the client accepts it
+	if encoded := entry.encodedFor(r.Header["Accept-Encoding"]); encoded != nil {
+		header["Content-Encoding"] = encoded.encoding
+		body, length = encoded.body, encoded.length
+	}
+	header["Content-Length"] = length
+	header["Content-Type"] = jsonContentType
+	if _, err := w.Write(body); err != nil && debug {
+		log.Println(err)
+	}
+	if debug {
+		log.Println("Sent back: " + string(entry.response))
+	}
+}
+
 // convert query parameter into a string to be used as index in the map
 func QueryAsString(r *http.Request) string {
+	return QueryValuesAsString(r.URL.Query())
+}
+
+// same string for already parsed query parameters, as the ones imported from other tools
+func QueryValuesAsString(values url.Values) string {
 
 	// try to get IN ORDER all the parameters
-	keys := []string{}
-	for k, _ := range r.URL.Query() {
+	keys := make([]string, 0, len(values))
+	for k := range values {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 
-	query := ""
+	var query strings.Builder
 	for _, k := range keys {
 		if k == DebugParameter {
 			continue
 		}
-		if len(query) > 0 {
-			query += "&"
+		if query.Len() > 0 {
+			query.WriteByte('&')
 		}
-		v := r.URL.Query()[k]
+		query.WriteString(k)
+		v := values[k]
 		if len(v) > 0 { // there might be repeated params
-			query += k + "="
+			query.WriteByte('=')
 			for i, w := range v {
 				if i > 0 {
-					query += ","
+					query.WriteByte(',')
 				}
-				query += w
+				query.WriteString(w)
 			}
-		} else {
-			// is a Flag
-			query += k
 		}
+		// otherwise is a Flag
 	}
-	return query
+	return query.String()
 }
@@ -0,0 +1,177 @@
+//go:build bench
+// +build bench
+
+package main
+
+// Benchmarks run in-process against the fixtures of the data folder, no NGINX needed:
+//   go test -tags bench -run ^$ -bench . -benchmem
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var benchDataDir = "../data/"
+var benchRequest = []byte(`{ "test": 1, "id": "1" }`)
+
+func benchHandler(b *testing.B) *customHandler {
+	log.SetOutput(ioutil.Discard)
+	reqresmap, reqSchema, err := loadMockRequestResponseFiles([]string{benchDataDir + MockRequestResponseFile},
+		benchDataDir+RequestJsonSchemaFile, benchDataDir+ResponseJsonSchemaFile, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return &customHandler{rrmap: reqresmap, reqSchema: reqSchema}
+}
+
+func serveBenchRequest(b *testing.B, handler http.Handler) {
+	r := httptest.NewRequest(http.MethodPost, "/testingEnd", bytes.NewReader(benchRequest))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		b.Fatalf("unexpected answer %d %s", w.Code, w.Body.String())
+	}
+}
+
+// whole request path: query, body and map look up
+func BenchmarkServeHTTP(b *testing.B) {
+	handler := benchHandler(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serveBenchRequest(b, handler)
+	}
+}
+
+// same path answering the gzip variant, compressed when loaded
+func BenchmarkServeHTTPGzip(b *testing.B) {
+	if err := setResponseEncodings("gzip"); err != nil {
+		b.Fatal(err)
+	}
+	defer setResponseEncodings("")
+	// fixtures at the data folder are too small to be worth compressing
+	reqresmap := newRequestResponseMap(1)
+	reqresmap.Add(`{"test":1,"id":"1"}`, QueryResponse{response: `{"id":"1","items":[` + strings.Repeat(`{"name":"item","price":10},`, 100) + `{}]}`})
+	handler := &customHandler{rrmap: reqresmap}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/testingEnd", bytes.NewReader(benchRequest))
+		r.Header.Set("Accept-Encoding", "gzip, deflate")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+			b.Fatalf("unexpected answer %d %v", w.Code, w.Header())
+		}
+	}
+}
+
+func BenchmarkServeHTTPParallel(b *testing.B) {
+	handler := benchHandler(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			serveBenchRequest(b, handler)
+		}
+	})
+}
+
+// how every request was validated before: schema parsed and compiled each time
+func BenchmarkValidateRequestUncompiled(b *testing.B) {
+	url, err := fileURL(benchDataDir + RequestJsonSchemaFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	loader := gojsonschema.NewReferenceLoader(url)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := gojsonschema.Validate(loader, gojsonschema.NewBytesLoader(benchRequest))
+		if err != nil || !result.Valid() {
+			b.Fatal("request must be valid")
+		}
+	}
+}
+
+func BenchmarkValidateRequestCompiled(b *testing.B) {
+	schema, err := loadSchemaFile(benchDataDir + RequestJsonSchemaFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !validateRequest(schema, string(benchRequest)) {
+			b.Fatal("request must be valid")
+		}
+	}
+}
+
+func BenchmarkLoadMockRequestResponseFiles(b *testing.B) {
+	log.SetOutput(ioutil.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, err := loadMockRequestResponseFiles([]string{benchDataDir + MockRequestResponseFile},
+			benchDataDir+RequestJsonSchemaFile, benchDataDir+ResponseJsonSchemaFile, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// look up among many fixtures, as big mapping files have
+func BenchmarkLookup(b *testing.B) {
+	reqresmap := newRequestResponseMap(100000)
+	for i := 0; i < 100000; i++ {
+		request := `{"id":"` + strconv.Itoa(i) + `","test":1}`
+		reqresmap.Add(mapKey("page=1", request), QueryResponse{query: "page=1", response: `{"id":` + strconv.Itoa(i) + `}`})
+	}
+	request := []byte(`{"id":"99999","test":1}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if reqresmap.lookup("page=1", request) == nil {
+			b.Fatal("fixture must be found")
+		}
+	}
+}
+
+// same look up at a prebuilt index on disk, with and without its cache
+func BenchmarkLookupIndex(b *testing.B) {
+	file := b.TempDir() + "/fixtures.idx"
+	writer, err := newIndexWriter(file)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 100000; i++ {
+		request := `{"id":"` + strconv.Itoa(i) + `","test":1}`
+		writer.add(mapKey("page=1", request), QueryResponse{query: "page=1", response: `{"id":` + strconv.Itoa(i) + `}`})
+	}
+	if err := writer.close(); err != nil {
+		b.Fatal(err)
+	}
+	request := []byte(`{"id":"99999","test":1}`)
+	for _, cache := range []int{0, IndexCacheEntries} {
+		store, err := openDiskStore(file, cache)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run("cache="+strconv.Itoa(cache), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if store.lookup("page=1", request) == nil {
+					b.Fatal("fixture must be found")
+				}
+			}
+		})
+	}
+}
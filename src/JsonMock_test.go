@@ -1,287 +1,115 @@
+//go:build !bench
+// +build !bench
+
 package main
 
 import (
+	"bufio"
 	"bytes"
-	"compress/gzip"
-	"encoding/json"
-	"errors"
 	"flag"
-	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"testing"
 )
 
-// Already declade at JsonMock
-var DataDir = "data"
-var MockRequestResponseFile = "requestResponseMap.json"
-
-// global due to lazyness
-var queryStr string
-var dataFile string
-var checkUp bool
-var gzipOn bool
-var goroutinesMax uint64
-
-// To process Json input file
-type ReqRes struct {
-	Qry string           `json:"query,omitempty"`
-	Req *json.RawMessage `json:"req"`
-	Res *json.RawMessage `json:"res"`
-}
+// the same flags as JsonMock loadtest, so CI keeps running: go test -run TestRequests -args -queryStr=...
+// unit tests alone, no server needed: go test -short
+var loadtest = loadtestFlags(flag.CommandLine)
 
 // read extra commandline arguments
 func init() {
+	flag.Var(&loadtest.maps, "dataFile", "Same as -map.")
+}
 
-	runtime.GOMAXPROCS(runtime.NumCPU())
-
-	flag.StringVar(&queryStr, "queryStr", "http://0.0.0.0/testingEnd?", "Testing End address, including 'debug' parameter if needed")
-	mockRequestResponseFile := filepath.Dir(os.Args[0]) + filepath.FromSlash("/") + DataDir + filepath.FromSlash("/") + MockRequestResponseFile
-	flag.StringVar(&dataFile, "dataFile", mockRequestResponseFile, "Data File with Request/Response map. No validation will be carried out.")
-	flag.BoolVar(&checkUp, "checkUp", true, "Check it out that FastCGI is up and running through a HEAD request.")
-	flag.BoolVar(&gzipOn, "gzipOn", true, "Activate GZIP by adding specific header to the request. That might make all tests fail")
-	flag.Uint64Var(&goroutinesMax, "goroutinesMax", uint64(3*runtime.NumCPU()), "Maximum number of goroutines in parallel in order to avoid hoarding too much resources.")
+// the loader logs every fixture it ignores, only worth reading with -v
+func TestMain(m *testing.M) {
 	flag.Parse()
-	if len(queryStr) < 2 || strings.Index(queryStr, "?") != (len(queryStr)-1) || strings.LastIndex(queryStr, "/") == (len(queryStr)-2) {
-		fmt.Printf("Check it out that your -queryStr %v is the correct one expected by NGINX and ends in '?'\n", queryStr)
-		os.Exit(1)
-	}
-	_, err := url.ParseRequestURI(queryStr)
-	if err != nil {
-		fmt.Printf("Check it out that your -queryStr %v is a correct URL\n", queryStr)
-		os.Exit(1)
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
 	}
+	os.Exit(m.Run())
 }
 
 func TestRequests(t *testing.T) {
 
-	// depends on your NGINX fastcgi configuration
-	t.Log("-queryStr=" + queryStr)
-	// depends on your test configuration
-	t.Log("-dataFile=" + dataFile)
-	// depends if the server under test supports HEAD queries
-	t.Logf("-checkUp=%t\n", checkUp)
-	// depends if the server under test supports GZIP
-	t.Logf("-gzipOn=s%t\n", gzipOn)
-	// depends on the test system resources
-	t.Logf("-goroutinesMax=%d\n", goroutinesMax)
-
-	// call that fastcgi to checkout whether it's up or not
-	if checkUp {
-		ping, err := http.Head(queryStr)
-		if err != nil {
-			t.Error("Unable to request for HEAD info to the server. " + err.Error())
-			t.FailNow()
-		}
-		if ping.StatusCode != http.StatusOK {
-			t.Error("Probably FastCGI down: " + ping.Status)
-			t.FailNow()
-		}
-	}
-	// grab the real queries to launch
-	dataMap, err := ioutil.ReadFile(dataFile)
-	if err != nil {
-		t.Error("Unable to read Mock Request Response File. " + err.Error())
-		t.FailNow()
-	}
-
-	// process json input
-	dec := json.NewDecoder(strings.NewReader(string(dataMap)))
-	err = ignoreFirstBracket(dec)
-	if err != nil {
-		t.Error("Unable to process Mock Request Response File. " + err.Error())
-		t.FailNow()
+	if testing.Short() {
+		t.Skip("a running server is needed")
 	}
 
-	// resquests stats
-	var failedRequests uint64
-	var successRequests uint64
-	var current uint64
-	var goroutinesRunning uint64
-
-	// Get multithread ready
-	var wg sync.WaitGroup
-
-	// read object {"req": string, "res": string}
-	for dec.More() {
-
-		var rr ReqRes
-		rr.Qry = ""
-		err = dec.Decode(&rr)
-		if err != nil || rr.Req == nil || rr.Res == nil {
-			t.Error("Unable to process Request Response object.")
-			t.FailNow()
-		}
-
-		// launch an extra goroutine
-		wg.Add(1)
-		go checkRequest(current, goroutinesRunning, t, &rr, &wg, &failedRequests, &successRequests)
-		current++
-		goroutinesRunning++
+	// depends on your NGINX fastcgi configuration
+	t.Log("-queryStr=" + loadtest.queryStr)
+	// depends on your test configuration
+	t.Log("-map=" + loadtest.maps.String())
 
-		// Wait a little when too much goroutines are running in order not to hoard too much resources
-		if goroutinesRunning >= goroutinesMax {
-			wg.Wait()
-			goroutinesRunning = 0
-		}
+	if err := loadtest.check(); err != nil {
+		t.Fatal(err)
 	}
-	err = ignoreLastBracket(dec)
+	report, err := runLoadtest(loadtest, func(failure string) { t.Error(failure) })
 	if err != nil {
-		t.Error("Unable to process Mock Request Response File. " + err.Error())
-		t.FailNow()
-	}
-
-	// Wait for all gorutines to finish
-	if goroutinesRunning > 0 {
-		wg.Wait()
+		t.Fatal(err)
 	}
 
-	failed := atomic.LoadUint64(&failedRequests)
-	success := atomic.LoadUint64(&successRequests)
-
-	if failedRequests > 0 {
-		t.Errorf("Failed Requests: %d\n", failed)
-		t.FailNow()
+	var summary bytes.Buffer
+	printLoadtestReport(&summary, report)
+	t.Log(summary.String())
+	if report.Failed > 0 {
+		t.Fatalf("Failed Requests: %d\n", report.Failed)
 	}
-
-	t.Logf("Total requests sent: %d: success %d, failed %d\n", failed+success, success, failed)
 }
 
-// process specif request
-func checkRequest(current uint64, goroutinesRunning uint64, t *testing.T, rr *ReqRes, wg *sync.WaitGroup, failed *uint64, success *uint64) {
+func TestServeH2C(t *testing.T) {
 
-	defer wg.Done()
+	defer func(protocol string) { Protocol = protocol }(Protocol)
+	Protocol = "h2c"
 
-	query := queryStr
-	if len(rr.Qry) > 0 {
-		query += rr.Qry
-	}
-
-	// create the request
-	req, err := toString(rr.Req)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		t.Error(err)
-		atomic.AddUint64(failed, 1)
-		return
-	}
-	request, err := http.NewRequest("POST", query, strings.NewReader(req))
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strconv.Itoa(r.ProtoMajor)))
+	})
+	go serve(listener, handler, nil)
+	url := "http://" + listener.Addr().String() + "/"
+
+	// prior knowledge, as loadtest -http2 does
+	h2c := &http.Client{Transport: loadtestHTTP2Transport(url, nil)}
+	response, err := h2c.Get(url)
 	if err != nil {
-		t.Errorf("<%d:%d> ["+query+"]"+req+": "+err.Error()+"\n", current, goroutinesRunning)
-		atomic.AddUint64(failed, 1)
-		return
+		t.Fatal(err)
 	}
-	request.Close = true
-
-	// headeres
-	if gzipOn {
-		request.Header.Add("Accept-Encoding", "gzip")
+	major, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.ProtoMajor != 2 || string(major) != "2" {
+		t.Errorf("prior knowledge served as %s, handler saw HTTP/%s", response.Proto, major)
 	}
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("Content-Length", strconv.Itoa(len(req)))
 
-	// making the call
-	client := &http.Client{}
-	response, err := client.Do(request)
+	// HTTP/1.1 clients keep working
+	response, err = http.Get(url)
 	if err != nil {
-		t.Errorf("<%d:%d> ["+query+"]"+req+": "+err.Error()+"\n", current, goroutinesRunning)
-		atomic.AddUint64(failed, 1)
-		return
+		t.Fatal(err)
 	}
-	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		t.Errorf("<%d:%d> ["+query+"]"+req+": "+err.Error()+"\n", current, goroutinesRunning)
-		atomic.AddUint64(failed, 1)
-		return
+	major, _ = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.ProtoMajor != 1 || string(major) != "1" {
+		t.Errorf("HTTP/1.1 served as %s, handler saw HTTP/%s", response.Proto, major)
 	}
 
-	// double check the response depending on GZIP usage
-	var reader io.ReadCloser
-	switch response.Header.Get("Content-Encoding") {
-	case "gzip":
-		reader, err = gzip.NewReader(response.Body)
-		defer reader.Close()
-	default:
-		reader = response.Body
-	}
-	res, err := ioutil.ReadAll(reader)
+	// and so does the upgrade from HTTP/1.1
+	conn, err := net.Dial("tcp", listener.Addr().String())
 	if err != nil {
-		t.Errorf("<%d:%d> ["+query+"]"+req+": "+err.Error()+"\n", current, goroutinesRunning)
-		atomic.AddUint64(failed, 1)
-		return
-	}
-	responseStr := string(res)
-
-	// what it's read from the file
-	expected, err := toString(rr.Res)
-	if err != nil {
-		t.Errorf("<%d:%d> ["+query+"]"+req+": "+err.Error()+"\n", current, goroutinesRunning)
-		atomic.AddUint64(failed, 1)
-		return
-	}
-	if strings.EqualFold(responseStr, expected) {
-		// success
-		atomic.AddUint64(success, 1)
-		return
-	}
-
-	// failure
-	t.Errorf("<%d:%d> ["+query+"]"+req+": received->"+responseStr+" expected->"+expected+"\n", current, goroutinesRunning)
-	atomic.AddUint64(failed, 1)
-	return
-}
-
-// convert into an string
-func toString(raw *json.RawMessage) (string, error) {
-	if raw != nil {
-		noSoRaw, err := json.Marshal(raw)
-		if err != nil {
-			log.Fatal(err)
-			return "", err
-		}
-		return string(noSoRaw), nil
-	} else {
-		return "", nil
+		t.Fatal(err)
 	}
-}
-
-// ignore first bracket when json mock Request Response file is decoded
-func ignoreFirstBracket(dec *json.Decoder) error {
-	_, err := dec.Token()
-	if err != nil {
-		log.Fatal(err)
-		return errors.New("Unable to process first token at Mock Request Response File")
-	}
-	return nil
-}
-
-// ignore last bracket when json mock Request Response file is decoded
-func ignoreLastBracket(dec *json.Decoder) error {
-	_, err := dec.Token()
-	if err != nil {
-		log.Fatal(err)
-		return errors.New("Unable to process last token at Mock Request Response File")
-	}
-	return nil
-}
-
-// compact json to make it easy to look into the map for equivalent keys
-func compactJson(loose []byte) (string, error) {
-
-	compactedBuffer := new(bytes.Buffer)
-	err := json.Compact(compactedBuffer, loose)
-	if err != nil {
-		log.Fatal(err)
-		return "", err
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: mock\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQCAAAAAAIAAAAA\r\n\r\n"))
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.HasPrefix(status, "HTTP/1.1 101 ") {
+		t.Errorf("upgrade answered %q, %v", status, err)
 	}
-	return compactedBuffer.String(), nil
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// subcommand of the JsonMock CLI
+type subcommand struct {
+	name    string
+	args    string // what follows its name at the usage line
+	summary string
+	run     func(args []string) int
+}
+
+// every subcommand, in the order help lists them; set at init since their usages look them up
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"serve", "[flags]", "Serve the fixtures: FastCGI behind NGINX, plain HTTP, h2c or HTTPS. Flags alone mean serve.", serveCommand},
+		{"record", "-upstream=<url> [flags]", "Forward every request to a real backend, appending its answers to -recordMap.", recordCommand},
+		{"validate", "[flags]", "Check the fixtures against their Json Schemas, reporting every issue.", validateCommand},
+		{"lint", "[flags]", "Look for fixtures no request would ever match and schema keywords not enforced.", lintCommand},
+		{"import", "-format=<" + strings.Join(importerNames(), "|") + "> -in=<file> [flags]", "Turn files of other tools into a mapping file.", importCommand},
+		{"export", "-format=<" + strings.Join(exporterNames(), "|") + "> [flags]", "Turn the fixtures into files of other tools.", exportCommand},
+		{"gen", "[flags]", "Make up fixtures complying with the Json Schemas.", genCommand},
+		{"infer", "[flags]", "Infer the Json Schemas of the fixtures.", inferCommand},
+		{"index", "[flags]", "Build an index of the fixtures, to serve them from disk.", indexCommand},
+		{"loadtest", "[flags]", "Send every fixture to a running server, concurrently, checking its answers.", loadtestCommand},
+		{"config", "print [flags]", "Print the effective configuration, out of the config file, env vars and flags.", configCommand},
+	}
+}
+
+func findSubcommand(name string) *subcommand {
+	for i := range subcommands {
+		if subcommands[i].name == name {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+// name the binary is run by, for usage lines
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// flags of a subcommand, -help printing its usage line, what it does and every flag
+func commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		out := flags.Output()
+		if command := findSubcommand(name); command != nil {
+			fmt.Fprintln(out, "Usage: "+programName()+" "+name+" "+command.args)
+			fmt.Fprintln(out)
+			fmt.Fprintln(out, command.summary)
+			fmt.Fprintln(out)
+		}
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// JsonMock help lists every subcommand, JsonMock help <command> tells about one of them
+func helpCommand(args []string) int {
+	if len(args) == 0 {
+		printSubcommands(os.Stdout)
+		return 0
+	}
+	command := findSubcommand(args[0])
+	if command == nil {
+		fmt.Fprintln(os.Stderr, "Unknown command "+args[0])
+		printSubcommands(os.Stderr)
+		return 2
+	}
+	return command.run([]string{"-help"})
+}
+
+func printSubcommands(out io.Writer) {
+	fmt.Fprintln(out, "Usage: "+programName()+" <command> [flags]")
+	fmt.Fprintln(out)
+	for _, command := range subcommands {
+		fmt.Fprintf(out, "  %-9s %s\n", command.name, command.summary)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "See "+programName()+" help <command> for its flags.")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ResponseEncodings compressed variants of every fixture response, kept since loaded; in order of preference, none by default
+var ResponseEncodings = ""
+
+// encodings in use, none until the server sets them so subcommands don't pay for them
+var responseEncodings []string
+
+// every supported Content-Encoding
+var responseEncoders = map[string]func(data []byte) ([]byte, error){
+	"gzip": gzipBytes,
+	"br":   brotliBytes,
+}
+
+// same answer, already compressed
+type encodedResponse struct {
+	encoding []string // Content-Encoding header
+	body     []byte
+	length   []string
+}
+
+var varyAcceptEncoding = []string{"Accept-Encoding"}
+
+// check and take a comma separated list of encodings, empty for none
+func setResponseEncodings(encodings string) error {
+	responseEncodings = nil
+	for _, encoding := range strings.Split(encodings, ",") {
+		encoding = strings.TrimSpace(encoding)
+		if len(encoding) == 0 {
+			continue
+		}
+		if _, ok := responseEncoders[encoding]; !ok {
+			return errors.New("Unable to compress responses as " + encoding + ". Supported: gzip, br")
+		}
+		responseEncodings = append(responseEncodings, encoding)
+	}
+	return nil
+}
+
+func compressEntry(entry *fixtureEntry) {
+	entry.encoded = compressResponse(entry.response)
+}
+
+// compressed variants of a response, only those smaller than the response itself
+func compressResponse(response []byte) []encodedResponse {
+	var encoded []encodedResponse
+	for _, encoding := range responseEncodings {
+		body, err := responseEncoders[encoding](response)
+		if err != nil {
+			log.Println("Unable to compress response as " + encoding + ": " + err.Error())
+			continue
+		}
+		if len(body) >= len(response) {
+			continue
+		}
+		encoded = append(encoded, newEncodedResponse(encoding, body))
+	}
+	return encoded
+}
+
+func newEncodedResponse(encoding string, body []byte) encodedResponse {
+	return encodedResponse{encoding: []string{encoding}, body: body, length: []string{strconv.Itoa(len(body))}}
+}
+
+// variants compressed beforehand, like those of an index: only the encodings in use, in their order
+func preferredEncodings(encoded []encodedResponse) []encodedResponse {
+	var preferred []encodedResponse
+	for _, encoding := range responseEncodings {
+		for _, variant := range encoded {
+			if variant.encoding[0] == encoding {
+				preferred = append(preferred, variant)
+			}
+		}
+	}
+	return preferred
+}
+
+// first variant the client accepts, if any
+func (entry *fixtureEntry) encodedFor(acceptEncoding []string) *encodedResponse {
+	for i := range entry.encoded {
+		for _, header := range acceptEncoding {
+			if acceptsEncoding(header, entry.encoded[i].encoding[0]) {
+				return &entry.encoded[i]
+			}
+		}
+	}
+	return nil
+}
+
+// whether an Accept-Encoding header allows an encoding: by name or *, unless its q is 0; its own name wins over *
+func acceptsEncoding(header string, encoding string) bool {
+	named, wildcard := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.TrimSpace(params[0])
+		if name != "*" && !strings.EqualFold(name, encoding) {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && strings.EqualFold(param[:2], "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			named = q
+		}
+	}
+	if named >= 0 {
+		return named > 0
+	}
+	return wildcard > 0
+}
+
+// compressors are reused, creating them costs more than compressing a small json
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+var brotliWriters = sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	writer := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(writer)
+	writer.Reset(&out)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func brotliBytes(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	writer := brotliWriters.Get().(*brotli.Writer)
+	defer brotliWriters.Put(writer)
+	writer.Reset(&out)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		want     bool
+	}{
+		{"gzip", "gzip", true},
+		{"GZIP", "gzip", true},
+		{"deflate, gzip;q=0.5", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.0", "gzip", false},
+		{"br", "gzip", false},
+		{"", "gzip", false},
+		{"*", "br", true},
+		{"*;q=0", "br", false},
+		{"*, gzip;q=0", "gzip", false},
+		{"gzip;q=0, *", "gzip", false},
+		{"*;q=0, gzip", "gzip", true},
+		{"*;q=0, gzip", "br", false},
+		{"identity, *;q=0.1", "br", true},
+	}
+	for _, test := range tests {
+		if got := acceptsEncoding(test.header, test.encoding); got != test.want {
+			t.Errorf("acceptsEncoding(%q, %q) = %t, want %t", test.header, test.encoding, got, test.want)
+		}
+	}
+}
+
+func TestEncodedFor(t *testing.T) {
+
+	defer setResponseEncodings("")
+	if err := setResponseEncodings("br,gzip"); err != nil {
+		t.Fatal(err)
+	}
+	entry := &fixtureEntry{response: []byte(`{"text":"` + strings.Repeat("compress me ", 50) + `"}`)}
+	compressEntry(entry)
+
+	tests := []struct {
+		accept []string
+		want   string // empty for the plain json
+	}{
+		{nil, ""},
+		{[]string{"gzip"}, "gzip"},
+		{[]string{"gzip, br"}, "br"},
+		{[]string{"*, br;q=0"}, "gzip"},
+		{[]string{"identity"}, ""},
+		{[]string{"identity", "gzip"}, "gzip"},
+	}
+	for _, test := range tests {
+		got := ""
+		if variant := entry.encodedFor(test.accept); variant != nil {
+			got = variant.encoding[0]
+		}
+		if got != test.want {
+			t.Errorf("encodedFor(%q) = %q, want %q", test.accept, got, test.want)
+		}
+	}
+
+	// not worth it for tiny responses
+	tiny := &fixtureEntry{response: []byte(`{}`)}
+	compressEntry(tiny)
+	if len(tiny.encoded) != 0 {
+		t.Errorf("tiny response compressed as %v", tiny.encoded)
+	}
+	if err := setResponseEncodings("gzip,zstd"); err == nil {
+		t.Error("unknown encodings must be refused")
+	}
+}
+
+func TestWriteFixtureVary(t *testing.T) {
+
+	defer setResponseEncodings("")
+	large := []byte(`{"text":"` + strings.Repeat("compress me ", 50) + `"}`)
+
+	tests := []struct {
+		name      string
+		encodings string
+		response  []byte
+		accept    string
+		vary      bool
+		encoding  string
+	}{
+		{"no compression", "", large, "gzip", false, ""},
+		{"compressed", "gzip", large, "gzip", true, "gzip"},
+		{"not accepted", "gzip", large, "", true, ""},
+		{"without variant", "gzip", []byte(`{}`), "gzip", true, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := setResponseEncodings(test.encodings); err != nil {
+				t.Fatal(err)
+			}
+			entry := &fixtureEntry{response: test.response, length: []string{strconv.Itoa(len(test.response))}}
+			compressEntry(entry)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if len(test.accept) > 0 {
+				r.Header.Set("Accept-Encoding", test.accept)
+			}
+			w := httptest.NewRecorder()
+			writeFixture(w, r, entry, false)
+			if vary := w.Header().Get("Vary") == "Accept-Encoding"; vary != test.vary {
+				t.Errorf("Vary %q", w.Header().Get("Vary"))
+			}
+			if encoding := w.Header().Get("Content-Encoding"); encoding != test.encoding {
+				t.Errorf("Content-Encoding %q, want %q", encoding, test.encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile yaml, json or toml file with the server settings, empty for none
+var ConfigFile = ""
+
+// env vars are named after the flags: JSONMOCK_TLS_AUTO for -tls-auto
+const configEnvPrefix = "JSONMOCK_"
+
+// Config server settings not kept at globals
+type Config struct {
+	Host      string
+	Port      string
+	Map       mapFlag
+	Req       string
+	Res       string
+	Debug     bool
+	RecordMap string
+	TLSAutoCA string
+	Services  []serviceConfig // listed at the config file itself
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Host:      "0.0.0.0",
+		Port:      "9797",
+		Map:       mapFlag{files: []string{dataFilePath(MockRequestResponseFile)}},
+		Req:       dataFilePath(RequestJsonSchemaFile),
+		Res:       dataFilePath(ResponseJsonSchemaFile),
+		Debug:     ForcedDebug,
+		RecordMap: dataFilePath(RecordMockFile),
+		TLSAutoCA: dataFilePath(TLSAutoCAFile),
+	}
+}
+
+// where a flag goes at the config file: key of its section, or of the top level with no section
+type configSetting struct {
+	section string
+	key     string
+	flag    string
+	file    bool // a path, relative to the config file
+}
+
+// every setting of the config file, in the order they are printed
+var configSettings = []configSetting{
+	{"listen", "host", "host", false},
+	{"listen", "port", "port", false},
+	{"listen", "address", "listen", false},
+	{"listen", "mode", "listen-mode", false},
+	{"listen", "protocol", "protocol", false},
+	{"tls", "cert", "tls-cert", true},
+	{"tls", "key", "tls-key", true},
+	{"tls", "auto", "tls-auto", false},
+	{"tls", "autoCa", "tls-auto-ca", true},
+	{"tls", "clientCa", "tls-client-ca", true},
+	{"fixtures", "map", "map", true},
+	{"fixtures", "index", "index", true},
+	{"fixtures", "cache", "cache", false},
+	{"fixtures", "openapi", "openapi", true},
+	{"fixtures", "compress", "compress", false},
+	{"schemas", "req", "req", true},
+	{"schemas", "res", "res", true},
+	{"matching", "debugParameter", "debug-param", false},
+	{"matching", "clientParam", "tls-client-param", false},
+	{"latency", "fixed", "latency", false},
+	{"latency", "jitter", "latency-jitter", false},
+	{"logging", "debug", "debug", false},
+	{"logging", "progress", "progress", false},
+	{"logging", "file", "log-file", true},
+	{"upstream", "record", "record", false},
+	{"upstream", "recordMap", "recordMap", true},
+	{"upstream", "proxy", "proxy", false},
+	{"upstream", "proxyStrict", "proxyStrict", false},
+	{"upstream", "diff", "diff", false},
+	{"upstream", "passThrough", "passThrough", false},
+	{"upstream", "passThroughRecord", "passThroughRecord", false},
+	{"", "services", "services", true},
+}
+
+// flags taking several values, one per Set
+type listValue interface {
+	values() []string
+}
+
+// env var overriding a flag
+func configEnv(flagName string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// command line flags first, then JSONMOCK_ env vars, then the config file; defaults for whatever none of them sets
+func loadConfig(flags *flag.FlagSet, config *Config, args []string) error {
+
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return errors.New("Unable to take argument " + flags.Arg(0) + ": every setting is a flag, see -help")
+	}
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if file, ok := os.LookupEnv(configEnv("config")); ok && !explicit["config"] {
+		ConfigFile = file
+	}
+	var values map[string]interface{}
+	if len(ConfigFile) > 0 {
+		var err error
+		if values, err = readConfigFile(ConfigFile); err != nil {
+			return err
+		}
+	}
+
+	for _, setting := range configSettings {
+		if explicit[setting.flag] {
+			continue
+		}
+		_, list := flags.Lookup(setting.flag).Value.(listValue)
+
+		if env, ok := os.LookupEnv(configEnv(setting.flag)); ok {
+			items := []string{env}
+			if list {
+				items = strings.Split(env, ",")
+			}
+			for _, item := range items {
+				if err := flags.Set(setting.flag, item); err != nil {
+					return errors.New("Unable to take " + configEnv(setting.flag) + "=" + env + ": " + err.Error())
+				}
+			}
+			continue
+		}
+
+		value, ok := configValue(values, setting)
+		if !ok {
+			continue
+		}
+		name := setting.key
+		if len(setting.section) > 0 {
+			name = setting.section + "." + name
+		}
+		// services might be listed right there, instead of at their own file
+		if services, ok := value.([]interface{}); ok && setting.flag == "services" {
+			data, _ := json.Marshal(services)
+			if err := json.Unmarshal(data, &config.Services); err != nil {
+				return errors.New("Unable to take " + name + " at " + ConfigFile + ": " + err.Error())
+			}
+			continue
+		}
+		items, err := configStrings(value, list)
+		if err != nil {
+			return errors.New("Unable to take " + name + " at " + ConfigFile + ": " + err.Error())
+		}
+		for _, item := range items {
+			if setting.file && len(item) > 0 {
+				item = relativeToFile(ConfigFile, item)
+			}
+			if err := flags.Set(setting.flag, item); err != nil {
+				return errors.New("Unable to take " + name + " at " + ConfigFile + ": " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// whole config file as json values, whatever its format; unknown settings are refused so typos don't go unnoticed
+func readConfigFile(file string) (map[string]interface{}, error) {
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New("Unable to read Config File: " + err.Error())
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		data, err = yamlToJson(data)
+	case ".toml":
+		var document map[string]interface{}
+		if _, err = toml.Decode(string(data), &document); err == nil {
+			data, err = json.Marshal(document)
+		}
+	}
+	if err != nil {
+		return nil, errors.New("Unable to process Config File: " + err.Error())
+	}
+
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, errors.New("Unable to process Config File: " + err.Error())
+	}
+
+	known := make(map[string]bool)
+	for _, setting := range configSettings {
+		known[setting.section] = true
+		known[setting.section+"."+setting.key] = true
+	}
+	for key, value := range values {
+		if known["."+key] {
+			continue
+		}
+		section, ok := value.(map[string]interface{})
+		if !ok || !known[key] {
+			return nil, errors.New("Unable to take " + key + " at " + file + ": unknown setting")
+		}
+		for name := range section {
+			if !known[key+"."+name] {
+				return nil, errors.New("Unable to take " + key + "." + name + " at " + file + ": unknown setting")
+			}
+		}
+	}
+	return values, nil
+}
+
+// value of a setting at the config file, if it is there
+func configValue(values map[string]interface{}, setting configSetting) (interface{}, bool) {
+	if len(setting.section) == 0 {
+		value, ok := values[setting.key]
+		return value, ok
+	}
+	section, ok := values[setting.section].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	value, ok := section[setting.key]
+	return value, ok
+}
+
+// a config value as flag values: one, or several for lists
+func configStrings(value interface{}, list bool) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+	case bool:
+		return []string{strconv.FormatBool(value)}, nil
+	case json.Number:
+		return []string{value.String()}, nil
+	case []interface{}:
+		if !list {
+			return nil, errors.New("a single value was expected")
+		}
+		var items []string
+		for _, item := range value {
+			values, err := configStrings(item, false)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, values...)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected value %v", value)
+}
+
+// shows the effective configuration: JsonMock config print [-format=yaml|json] [server flags]
+func configCommand(args []string) int {
+
+	format := "yaml"
+	config := defaultConfig()
+	flags := serverFlags("config", config)
+	flags.StringVar(&format, "format", format, "Either yaml or json.")
+	if len(args) == 0 || args[0] != "print" {
+		flags.Usage()
+		return 2
+	}
+	if err := loadConfig(flags, config, args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	document, err := configDocument(flags, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var printed bytes.Buffer
+	encoder := yaml.NewEncoder(&printed)
+	encoder.SetIndent(2)
+	err = encoder.Encode(document)
+	out := printed.Bytes()
+	if err == nil && format == "json" {
+		if out, err = yamlToJson(out); err == nil {
+			var indented bytes.Buffer
+			err = json.Indent(&indented, out, "", "  ")
+			out = append(indented.Bytes(), '\n')
+		}
+	} else if err == nil && format != "yaml" {
+		err = errors.New("Unable to print the config as " + format + ": either yaml or json")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
+
+// every setting as it would be written at a yaml config file, in order
+func configDocument(flags *flag.FlagSet, config *Config) (*yaml.Node, error) {
+
+	document := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+	for _, setting := range configSettings {
+		var value *yaml.Node
+		if setting.flag == "services" && len(ServicesFile) == 0 && len(config.Services) > 0 {
+			data, err := json.Marshal(config.Services)
+			if err != nil {
+				return nil, err
+			}
+			var services yaml.Node
+			if err := yaml.Unmarshal(data, &services); err != nil {
+				return nil, err
+			}
+			value = services.Content[0]
+			blockStyle(value)
+		} else {
+			value = flagNode(flags.Lookup(setting.flag).Value)
+		}
+
+		parent := document
+		if len(setting.section) > 0 {
+			if parent = sections[setting.section]; parent == nil {
+				parent = &yaml.Node{Kind: yaml.MappingNode}
+				sections[setting.section] = parent
+				document.Content = append(document.Content, scalarNode("!!str", setting.section), parent)
+			}
+		}
+		parent.Content = append(parent.Content, scalarNode("!!str", setting.key), value)
+	}
+	return document, nil
+}
+
+// yaml value of a flag, keeping its type
+func flagNode(value flag.Value) *yaml.Node {
+	if list, ok := value.(listValue); ok {
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range list.values() {
+			node.Content = append(node.Content, scalarNode("!!str", item))
+		}
+		return node
+	}
+	getter, ok := value.(flag.Getter)
+	if !ok {
+		return scalarNode("!!str", value.String())
+	}
+	switch typed := getter.Get().(type) {
+	case bool:
+		return scalarNode("!!bool", strconv.FormatBool(typed))
+	case int:
+		return scalarNode("!!int", strconv.Itoa(typed))
+	case time.Duration:
+		return scalarNode("!!str", typed.String())
+	}
+	return scalarNode("!!str", value.String())
+}
+
+// as written by hand, not as json
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func scalarNode(tag string, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfig(t *testing.T) {
+
+	// every call starts from the same defaults, whatever the previous ones did
+	first := defaultConfig()
+	serverFlags("serve", first)
+	second := defaultConfig()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("defaults changed\n%+v\n%+v", first, second)
+	}
+	if second.RecordMap != dataFilePath(RecordMockFile) || second.TLSAutoCA != dataFilePath(TLSAutoCAFile) {
+		t.Errorf("recordMap %s, tls-auto-ca %s", second.RecordMap, second.TLSAutoCA)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+
+	// settings kept at globals are restored afterwards
+	defer func(configFile string, latency time.Duration, debugParam string) {
+		ConfigFile, Latency, DebugParameter = configFile, latency, debugParam
+	}(ConfigFile, Latency, DebugParameter)
+
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	yamlFile := write("jsonmock.yaml", `listen:
+  host: file
+  port: 7000
+fixtures:
+  map: [a.json, /abs/b.json]
+latency:
+  fixed: 20ms
+matching:
+  debugParameter: trace
+`)
+	tomlFile := write("jsonmock.toml", "[listen]\nhost = \"toml\"\nport = 7001\n[fixtures]\nmap = \"c.json\"\n")
+	jsonFile := write("jsonmock.json", `{"listen":{"host":"json"},"schemas":{"req":"req.json"}}`)
+	unknown := write("unknown.yaml", "listen:\n  hots: typo\n")
+	notList := write("notlist.yaml", "listen:\n  host: [a, b]\n")
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		host    string
+		port    string
+		maps    []string // nil for the default one
+		req     string   // empty for the default one
+		latency time.Duration
+		debug   string
+		err     bool
+	}{
+		{"defaults", nil, nil, "0.0.0.0", "9797", nil, "", 0, "debug", false},
+		{"yaml file", []string{"-config=" + yamlFile}, nil, "file", "7000",
+			[]string{filepath.Join(dir, "a.json"), "/abs/b.json"}, "", 20 * time.Millisecond, "trace", false},
+		{"toml file", []string{"-config=" + tomlFile}, nil, "toml", "7001", []string{filepath.Join(dir, "c.json")}, "", 0, "debug", false},
+		{"json file", []string{"-config=" + jsonFile}, nil, "json", "9797", nil, filepath.Join(dir, "req.json"), 0, "debug", false},
+		{"config file from env", nil, map[string]string{"JSONMOCK_CONFIG": tomlFile}, "toml", "7001", []string{filepath.Join(dir, "c.json")}, "", 0, "debug", false},
+		{"env over file", []string{"-config=" + yamlFile}, map[string]string{"JSONMOCK_HOST": "env", "JSONMOCK_MAP": "x.json,y.json", "JSONMOCK_LATENCY": "5ms"},
+			"env", "7000", []string{"x.json", "y.json"}, "", 5 * time.Millisecond, "trace", false},
+		{"flags over env", []string{"-config=" + yamlFile, "-host=flag", "-map=f.json", "-debug-param=dbg"}, map[string]string{"JSONMOCK_HOST": "env", "JSONMOCK_MAP": "x.json"},
+			"flag", "7000", []string{"f.json"}, "", 20 * time.Millisecond, "dbg", false},
+		{"config flag over env", []string{"-config=" + jsonFile}, map[string]string{"JSONMOCK_CONFIG": tomlFile}, "json", "9797", nil, filepath.Join(dir, "req.json"), 0, "debug", false},
+		{"unknown setting", []string{"-config=" + unknown}, nil, "", "", nil, "", 0, "", true},
+		{"list for a single value", []string{"-config=" + notList}, nil, "", "", nil, "", 0, "", true},
+		{"wrong env value", nil, map[string]string{"JSONMOCK_LATENCY": "soon"}, "", "", nil, "", 0, "", true},
+		{"positional argument", []string{"file"}, nil, "", "", nil, "", 0, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			ConfigFile, Latency, DebugParameter = "", 0, "debug"
+			config := defaultConfig()
+			defaultMaps := config.Map.files
+			defaultReq := config.Req
+			flags := serverFlags("serve", config)
+
+			err := loadConfig(flags, config, test.args)
+			if (err != nil) != test.err {
+				t.Fatalf("error %v", err)
+			}
+			if test.err {
+				return
+			}
+			maps, req := test.maps, test.req
+			if maps == nil {
+				maps = defaultMaps
+			}
+			if len(req) == 0 {
+				req = defaultReq
+			}
+			if config.Host != test.host || config.Port != test.port || !reflect.DeepEqual(config.Map.files, maps) || config.Req != req {
+				t.Errorf("host %s, port %s, map %v, req %s; want %s, %s, %v, %s", config.Host, config.Port, config.Map.files, config.Req, test.host, test.port, maps, req)
+			}
+			if Latency != test.latency || DebugParameter != test.debug {
+				t.Errorf("latency %v, debug parameter %s; want %v, %s", Latency, DebugParameter, test.latency, test.debug)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiffUpstream real backend to compare fixtures with, empty means no diff mode
+var DiffUpstream = ""
+
+// DiffConcurrency background calls to the real backend at the same time; extra ones are skipped
+var DiffConcurrency = 16
+
+// AdminPrefix of the admin endpoints, out of the mocked api
+var AdminPrefix = "/_admin"
+
+// single json patch operation turning the mock answer into the real one
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// value is mandatory but for remove operations, even when it's null
+func (p PatchOperation) MarshalJSON() ([]byte, error) {
+	if p.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{p.Op, p.Path})
+	}
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{p.Op, p.Path, p.Value})
+}
+
+// fixture that doesn't match the real backend any more
+type Drift struct {
+	Key       string           `json:"key"`
+	Query     string           `json:"query,omitempty"`
+	Request   json.RawMessage  `json:"req"`
+	Status    int              `json:"status"`
+	Patch     []PatchOperation `json:"patch"`
+	Count     uint64           `json:"count"`
+	FirstSeen time.Time        `json:"firstSeen"`
+	LastSeen  time.Time        `json:"lastSeen"`
+}
+
+// shadow mode: mock answers, real backend is called in background to look for drifts
+type shadowDiff struct {
+	upstream string
+	client   *http.Client
+	slots    chan bool
+	mutex    sync.Mutex
+	drifts   map[string]*Drift
+	compared uint64
+	skipped  uint64
+	failed   uint64
+}
+
+// shadow diff against a real backend
+func newShadowDiff(upstream string) *shadowDiff {
+	return &shadowDiff{
+		upstream: upstream,
+		client:   &http.Client{Timeout: UpstreamTimeout},
+		slots:    make(chan bool, DiffConcurrency),
+		drifts:   make(map[string]*Drift),
+	}
+}
+
+// compare in background what the mock has just answered with the real backend
+func (d *shadowDiff) compare(r *http.Request, key string, query string, body []byte, mocked string, debug bool) {
+
+	select {
+	case d.slots <- true:
+	default:
+		atomic.AddUint64(&d.skipped, 1)
+		return
+	}
+
+	// original request is not available once answered
+	shadow := r.Clone(context.Background())
+	go func() {
+		defer func() { <-d.slots }()
+
+		response, answer, err := forwardRequest(d.client, d.upstream, shadow, body)
+		if err != nil {
+			atomic.AddUint64(&d.failed, 1)
+			log.Println("Diff: " + err.Error())
+			return
+		}
+		atomic.AddUint64(&d.compared, 1)
+
+		var patch []PatchOperation
+		if response.StatusCode == http.StatusOK {
+			patch, err = jsonDiff([]byte(mocked), answer)
+			if err != nil {
+				patch = []PatchOperation{{Op: "replace", Path: "", Value: string(answer)}}
+			}
+		}
+		if response.StatusCode == http.StatusOK && len(patch) == 0 {
+			if debug {
+				log.Println("Diff: no drift for " + key)
+			}
+			return
+		}
+		d.drifted(key, query, body, response.StatusCode, patch)
+	}()
+}
+
+// keep the last difference found for a fixture
+func (d *shadowDiff) drifted(key string, query string, body []byte, status int, patch []PatchOperation) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	drift, ok := d.drifts[key]
+	if !ok {
+		request, err := compactObject(body)
+		if err != nil {
+			request = strconv.Quote(string(body))
+		}
+		drift = &Drift{Key: key, Query: query, Request: json.RawMessage(request), FirstSeen: now}
+		d.drifts[key] = drift
+		log.Println("Diff: fixture drifted from upstream " + key)
+	}
+	drift.Status = status
+	drift.Patch = patch
+	drift.Count++
+	drift.LastSeen = now
+}
+
+// GET reports every drift, DELETE forgets them
+func (d *shadowDiff) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method == http.MethodDelete {
+		d.mutex.Lock()
+		d.drifts = make(map[string]*Drift)
+		d.mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	d.mutex.Lock()
+	drifts := make([]*Drift, 0, len(d.drifts))
+	for _, drift := range d.drifts {
+		drifts = append(drifts, drift)
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Key < drifts[j].Key })
+	report, err := json.MarshalIndent(struct {
+		Upstream string   `json:"upstream"`
+		Compared uint64   `json:"compared"`
+		Skipped  uint64   `json:"skipped"`
+		Failed   uint64   `json:"failed"`
+		Drifts   []*Drift `json:"drifts"`
+	}{d.upstream, atomic.LoadUint64(&d.compared), atomic.LoadUint64(&d.skipped), atomic.LoadUint64(&d.failed), drifts}, "", "  ")
+	d.mutex.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(report)
+}
+
+// semantic difference between two json documents, as json patch operations from mocked to real
+func jsonDiff(mocked []byte, real []byte) ([]PatchOperation, error) {
+	var from, to interface{}
+	if err := decodeNumbers(mocked, &from); err != nil {
+		return nil, err
+	}
+	if err := decodeNumbers(real, &to); err != nil {
+		return nil, err
+	}
+	return diffValues("", from, to, nil), nil
+}
+
+// numbers kept as json.Number so 1 and 1.0 are compared by value, not by text
+func decodeNumbers(doc []byte, value *interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	return dec.Decode(value)
+}
+
+func diffValues(path string, from interface{}, to interface{}, patch []PatchOperation) []PatchOperation {
+
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		toValue, ok := to.(map[string]interface{})
+		if !ok {
+			return append(patch, PatchOperation{Op: "replace", Path: path, Value: to})
+		}
+		keys := make([]string, 0, len(fromValue)+len(toValue))
+		for k := range fromValue {
+			keys = append(keys, k)
+		}
+		for k := range toValue {
+			if _, ok := fromValue[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + escapePointer(k)
+			fromChild, inFrom := fromValue[k]
+			toChild, inTo := toValue[k]
+			switch {
+			case !inTo:
+				patch = append(patch, PatchOperation{Op: "remove", Path: child})
+			case !inFrom:
+				patch = append(patch, PatchOperation{Op: "add", Path: child, Value: toChild})
+			default:
+				patch = diffValues(child, fromChild, toChild, patch)
+			}
+		}
+		return patch
+	case []interface{}:
+		toValue, ok := to.([]interface{})
+		if !ok {
+			return append(patch, PatchOperation{Op: "replace", Path: path, Value: to})
+		}
+		common := len(fromValue)
+		if len(toValue) < common {
+			common = len(toValue)
+		}
+		for i := 0; i < common; i++ {
+			patch = diffValues(path+"/"+strconv.Itoa(i), fromValue[i], toValue[i], patch)
+		}
+		// removed from the end so indexes keep being valid
+		for i := len(fromValue) - 1; i >= common; i-- {
+			patch = append(patch, PatchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(toValue); i++ {
+			patch = append(patch, PatchOperation{Op: "add", Path: path + "/-", Value: toValue[i]})
+		}
+		return patch
+	case json.Number:
+		toValue, ok := to.(json.Number)
+		if ok && sameNumber(fromValue, toValue) {
+			return patch
+		}
+		return append(patch, PatchOperation{Op: "replace", Path: path, Value: to})
+	default:
+		if from == to {
+			return patch
+		}
+		return append(patch, PatchOperation{Op: "replace", Path: path, Value: to})
+	}
+}
+
+func sameNumber(a json.Number, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	x, errA := a.Float64()
+	y, errB := b.Float64()
+	if errA != nil || errB != nil || x != y {
+		return false
+	}
+	// beyond float64 precision, as big integer ids
+	bigA, _, errA := big.ParseFloat(string(a), 10, 1024, big.ToNearestEven)
+	bigB, _, errB := big.ParseFloat(string(b), 10, 1024, big.ToNearestEven)
+	return errA == nil && errB == nil && bigA.Cmp(bigB) == 0
+}
+
+// json pointer escaping, RFC 6901
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJsonDiff(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		mocked string
+		real   string
+		patch  string
+	}{
+		{"same", `{"a":1,"b":[1,"x"]}`, `{ "b": [1, "x"], "a": 1 }`, `null`},
+		{"same numbers", `{"n":1,"f":0.5}`, `{"n":1.0,"f":5e-1}`, `null`},
+		{"replaced", `{"a":1,"b":"x","c":true}`, `{"a":2,"b":"y","c":false}`,
+			`[{"op":"replace","path":"/a","value":2},{"op":"replace","path":"/b","value":"y"},{"op":"replace","path":"/c","value":false}]`},
+		{"added and removed", `{"a":1,"gone":{"x":1}}`, `{"a":1,"new":null}`,
+			`[{"op":"remove","path":"/gone"},{"op":"add","path":"/new","value":null}]`},
+		{"nested", `{"a":{"b":{"c":1}}}`, `{"a":{"b":{"c":1,"d":[2]}}}`, `[{"op":"add","path":"/a/b/d","value":[2]}]`},
+		{"type changed", `{"a":[1],"b":{"x":1},"c":"1"}`, `{"a":{"0":1},"b":[1],"c":1}`,
+			`[{"op":"replace","path":"/a","value":{"0":1}},{"op":"replace","path":"/b","value":[1]},{"op":"replace","path":"/c","value":1}]`},
+		{"to null", `{"a":1}`, `{"a":null}`, `[{"op":"replace","path":"/a","value":null}]`},
+		{"array shrunk", `{"l":[1,2,3,4]}`, `{"l":[1,5]}`,
+			`[{"op":"replace","path":"/l/1","value":5},{"op":"remove","path":"/l/3"},{"op":"remove","path":"/l/2"}]`},
+		{"array grown", `{"l":[{"id":1}]}`, `{"l":[{"id":2},{"id":3},4]}`,
+			`[{"op":"replace","path":"/l/0/id","value":2},{"op":"add","path":"/l/-","value":{"id":3}},{"op":"add","path":"/l/-","value":4}]`},
+		{"escaped pointer", `{"a/b":1,"c~d":1}`, `{"a/b":2}`,
+			`[{"op":"replace","path":"/a~1b","value":2},{"op":"remove","path":"/c~0d"}]`},
+		{"whole document", `{"a":1}`, `[1]`, `[{"op":"replace","path":"","value":[1]}]`},
+		{"big numbers", `{"n":12345678901234567890}`, `{"n":12345678901234567891}`, `[{"op":"replace","path":"/n","value":12345678901234567891}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := jsonDiff([]byte(test.mocked), []byte(test.real))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.patch {
+				t.Errorf("patch\n%s\nwant\n%s", got, test.patch)
+			}
+		})
+	}
+
+	if _, err := jsonDiff([]byte(`{"a":`), []byte(`{}`)); err == nil {
+		t.Error("broken json must be reported")
+	}
+}
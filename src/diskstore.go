@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IndexFile prebuilt index of fixtures looked up on disk, instead of loading the mapping files
+var IndexFile = ""
+
+// IndexCacheEntries fixtures of the index kept in memory, the least recently used ones are dropped first
+var IndexCacheEntries = 10000
+
+// index file layout, little endian. Header: magic, number of fixtures, number of slots and offset of the slots table.
+// Records: key, query, response and variants lengths as uint32, followed by the key, the response and the variants.
+// Variants: encoding and body lengths as uint32, followed by the encoding name and the compressed body.
+// Slots table: hash and record offset as uint64, open addressing with linear probing; offset 0 is an empty slot.
+const (
+	indexMagic             = "JMINDEX2"
+	indexHeaderSize        = 32
+	indexRecordHeaderSize  = 16
+	indexVariantHeaderSize = 8
+	indexSlotSize          = 16
+)
+
+// builds the index of the fixtures: JsonMock index -map=... -req=... -res=... -out=...
+func indexCommand(args []string) int {
+
+	out := dataFilePath("requestResponseMap.idx")
+	mockRequestResponseFiles := mapFlag{files: []string{dataFilePath(MockRequestResponseFile)}}
+	requestJsonSchemaFile := dataFilePath(RequestJsonSchemaFile)
+	responseJsonSchemaFile := dataFilePath(ResponseJsonSchemaFile)
+	encodings := ""
+
+	flags := commandFlags("index")
+	flags.StringVar(&out, "out", out, "Index file to write.")
+	flags.Var(&mockRequestResponseFiles, "map", "Fake mapped request/response file, directory or glob. Can be repeated.")
+	flags.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Json Schema to validate requests.")
+	flags.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Json Schema to validate responses.")
+	flags.IntVar(&LoadProgressEntries, "progress", LoadProgressEntries, "Mapping file entries loaded between progress logs. 0 for none.")
+	flags.StringVar(&encodings, "compress", encodings, "Compressed variants of every response written to the index: gzip, br. Served when -compress asks for them too.")
+	flags.Parse(args)
+
+	if err := setResponseEncodings(encodings); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	files, err := expandMapFiles(mockRequestResponseFiles.files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	writer, err := newIndexWriter(out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to write "+out+": "+err.Error())
+		return 1
+	}
+	// fixtures go straight to disk, only their hashes and offsets are kept meanwhile
+	var set mockFileSet
+	for _, file := range files {
+		fixtures := 0
+		fileRequestSchema, err := forEachValidFixture(file, requestJsonSchemaFile, responseJsonSchemaFile, false, func(key string, value QueryResponse) bool {
+			fixtures++
+			return writer.add(key, value)
+		})
+		if err == nil {
+			err = set.loaded(fileRequestSchema, fixtures)
+		}
+		if err != nil {
+			writer.close()
+			os.Remove(out)
+			fmt.Fprintln(os.Stderr, "Unable to index "+file+": "+err.Error())
+			return 1
+		}
+	}
+	if err := writer.close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to write "+out+": "+err.Error())
+		return 1
+	}
+	if len(writer.offsets) == 0 {
+		os.Remove(out)
+		fmt.Fprintln(os.Stderr, "Unable to validate any entry at Mock Request Response Files")
+		return 1
+	}
+	fmt.Printf("%s: %d fixtures indexed\n", out, len(writer.offsets))
+	// the server only knows the index, not the headers of its mapping files
+	if len(set.requestSchemas) > 1 {
+		fmt.Println("Mapping files apply different request schemas, " + strings.Join(set.requestSchemas, ", ") + ": serve it with a -req accepting any of them")
+	} else if filepath.Clean(set.requestSchemas[0]) != filepath.Clean(requestJsonSchemaFile) {
+		fmt.Println("Serve it with -req=" + set.requestSchemas[0])
+	}
+	return 0
+}
+
+// writes the records as they come and the slots table at the end
+type indexWriter struct {
+	file    *os.File
+	out     *bufio.Writer
+	offset  int64
+	hashes  []uint64
+	offsets []int64
+	first   map[uint64]int32 // last record with that hash, plus one
+	next    []int32          // previous record with the same hash, plus one
+	err     error
+}
+
+func newIndexWriter(file string) (*indexWriter, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	w := &indexWriter{file: f, out: bufio.NewWriterSize(f, 1024*1024), offset: indexHeaderSize, first: make(map[uint64]int32)}
+	// header is known at the end only
+	if _, err := w.out.Write(make([]byte, indexHeaderSize)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// append a fixture unless its key is already there; first one wins
+func (w *indexWriter) add(key string, value QueryResponse) bool {
+	if w.err != nil {
+		return true
+	}
+	hash := hashString(hashOffset, key)
+	for at := w.first[hash]; at > 0; at = w.next[at-1] {
+		// duplicates and collisions are told apart reading the key back
+		if err := w.out.Flush(); err != nil {
+			w.err = err
+			return true
+		}
+		entry, err := readIndexEntry(w.file, w.offsets[at-1])
+		if err != nil {
+			w.err = err
+			return true
+		}
+		if entry.key == key {
+			return false
+		}
+	}
+
+	// compressed at index time, so serving it costs nothing per request
+	variants := compressResponse([]byte(value.response))
+	variantsLength := 0
+	for _, variant := range variants {
+		variantsLength += indexVariantHeaderSize + len(variant.encoding[0]) + len(variant.body)
+	}
+
+	var header [indexRecordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(value.query)))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(value.response)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(variantsLength))
+	w.out.Write(header[:])
+	w.out.WriteString(key)
+	w.out.WriteString(value.response)
+	for _, variant := range variants {
+		var variantHeader [indexVariantHeaderSize]byte
+		binary.LittleEndian.PutUint32(variantHeader[0:], uint32(len(variant.encoding[0])))
+		binary.LittleEndian.PutUint32(variantHeader[4:], uint32(len(variant.body)))
+		w.out.Write(variantHeader[:])
+		w.out.WriteString(variant.encoding[0])
+		w.out.Write(variant.body)
+	}
+
+	w.hashes = append(w.hashes, hash)
+	w.offsets = append(w.offsets, w.offset)
+	w.next = append(w.next, w.first[hash])
+	w.first[hash] = int32(len(w.offsets))
+	w.offset += int64(indexRecordHeaderSize + len(key) + len(value.response) + variantsLength)
+	return true
+}
+
+func (w *indexWriter) close() error {
+	defer w.file.Close()
+	if w.err != nil {
+		return w.err
+	}
+
+	// at most half of the slots in use, so probing ends soon
+	slots := uint64(1)
+	for slots < 2*uint64(len(w.offsets)) {
+		slots *= 2
+	}
+	table := make([]byte, slots*indexSlotSize)
+	for i, hash := range w.hashes {
+		slot := hash & (slots - 1)
+		for binary.LittleEndian.Uint64(table[slot*indexSlotSize+8:]) != 0 {
+			slot = (slot + 1) & (slots - 1)
+		}
+		binary.LittleEndian.PutUint64(table[slot*indexSlotSize:], hash)
+		binary.LittleEndian.PutUint64(table[slot*indexSlotSize+8:], uint64(w.offsets[i]))
+	}
+	w.out.Write(table)
+	if err := w.out.Flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, indexHeaderSize)
+	copy(header, indexMagic)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(w.offsets)))
+	binary.LittleEndian.PutUint64(header[16:], slots)
+	binary.LittleEndian.PutUint64(header[24:], uint64(w.offset))
+	if _, err := w.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// record of the index at that offset
+func readIndexEntry(file io.ReaderAt, offset int64) (*fixtureEntry, error) {
+
+	var header [indexRecordHeaderSize]byte
+	if _, err := file.ReadAt(header[:], offset); err != nil {
+		return nil, err
+	}
+	keyLength := binary.LittleEndian.Uint32(header[0:])
+	queryLength := binary.LittleEndian.Uint32(header[4:])
+	responseLength := binary.LittleEndian.Uint32(header[8:])
+	variantsLength := binary.LittleEndian.Uint32(header[12:])
+	wrong := errors.New("Unable to read index record at " + strconv.FormatInt(offset, 10))
+	if queryLength > 0 && uint64(queryLength)+2 > uint64(keyLength) {
+		return nil, wrong
+	}
+
+	data := make([]byte, uint64(keyLength)+uint64(responseLength)+uint64(variantsLength))
+	if _, err := file.ReadAt(data, offset+indexRecordHeaderSize); err != nil {
+		return nil, err
+	}
+	key := string(data[:keyLength])
+	response := data[keyLength : keyLength+responseLength]
+	entry := &fixtureEntry{key: key, response: response, length: []string{strconv.FormatUint(uint64(responseLength), 10)}}
+	if queryLength > 0 {
+		entry.query = key[1 : 1+queryLength]
+	}
+
+	for variants := data[keyLength+responseLength:]; len(variants) > 0; {
+		if len(variants) < indexVariantHeaderSize {
+			return nil, wrong
+		}
+		encodingLength := uint64(binary.LittleEndian.Uint32(variants[0:]))
+		bodyLength := uint64(binary.LittleEndian.Uint32(variants[4:]))
+		variants = variants[indexVariantHeaderSize:]
+		if encodingLength+bodyLength > uint64(len(variants)) {
+			return nil, wrong
+		}
+		encoding := string(variants[:encodingLength])
+		entry.encoded = append(entry.encoded, newEncodedResponse(encoding, variants[encodingLength:encodingLength+bodyLength]))
+		variants = variants[encodingLength+bodyLength:]
+	}
+	return entry, nil
+}
+
+// fixtures looked up at a prebuilt index, the most used ones kept in memory
+type diskStore struct {
+	file  *os.File
+	count int
+	mask  uint64
+	table int64
+	cache *fixtureCache
+}
+
+func openDiskStore(file string, cacheEntries int) (*diskStore, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, indexHeaderSize)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[:len(indexMagic)]) != indexMagic {
+		f.Close()
+		return nil, errors.New("Unable to read index file " + file + ". Build it with: JsonMock index")
+	}
+	slots := binary.LittleEndian.Uint64(header[16:])
+	if slots == 0 || slots&(slots-1) != 0 {
+		f.Close()
+		return nil, errors.New("Unable to read index file " + file + ": wrong slots table")
+	}
+	return &diskStore{
+		file:  f,
+		count: int(binary.LittleEndian.Uint64(header[8:])),
+		mask:  slots - 1,
+		table: int64(binary.LittleEndian.Uint64(header[24:])),
+		cache: newFixtureCache(cacheEntries),
+	}, nil
+}
+
+func (s *diskStore) Len() int {
+	return s.count
+}
+
+func (s *diskStore) lookup(query string, request []byte) *fixtureEntry {
+
+	hash := hashKey(query, request)
+	if entry := s.cache.get(hash, query, request); entry != nil {
+		return entry
+	}
+
+	var slot [indexSlotSize]byte
+	for at := hash & s.mask; ; at = (at + 1) & s.mask {
+		if _, err := s.file.ReadAt(slot[:], s.table+int64(at)*indexSlotSize); err != nil {
+			log.Println(err)
+			return nil
+		}
+		offset := int64(binary.LittleEndian.Uint64(slot[8:]))
+		if offset == 0 {
+			return nil
+		}
+		if binary.LittleEndian.Uint64(slot[:]) != hash {
+			continue
+		}
+		entry, err := readIndexEntry(s.file, offset)
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		if sameKey(entry.key, query, request) {
+			entry.encoded = preferredEncodings(entry.encoded)
+			s.cache.add(hash, entry)
+			return entry
+		}
+	}
+}
+
+// least recently used fixtures of a disk store
+type fixtureCache struct {
+	mutex    sync.Mutex
+	capacity int
+	elements map[uint64]*list.Element
+	order    *list.List // most recent first
+}
+
+type cachedFixture struct {
+	hash  uint64
+	entry *fixtureEntry
+}
+
+func newFixtureCache(capacity int) *fixtureCache {
+	return &fixtureCache{capacity: capacity, elements: make(map[uint64]*list.Element), order: list.New()}
+}
+
+func (c *fixtureCache) get(hash uint64, query string, request []byte) *fixtureEntry {
+	if c.capacity <= 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.elements[hash]
+	if !ok {
+		return nil
+	}
+	cached := element.Value.(*cachedFixture)
+	if !sameKey(cached.entry.key, query, request) {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return cached.entry
+}
+
+func (c *fixtureCache) add(hash uint64, entry *fixtureEntry) {
+	if c.capacity <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// same hash, another key: the last one looked up stays
+	if element, ok := c.elements[hash]; ok {
+		element.Value = &cachedFixture{hash: hash, entry: entry}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.elements[hash] = c.order.PushFront(&cachedFixture{hash: hash, entry: entry})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.elements, oldest.Value.(*cachedFixture).hash)
+	}
+}
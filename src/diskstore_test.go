@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiskStoreCompressedVariants(t *testing.T) {
+
+	defer setResponseEncodings("")
+	response := `{"text":"` + strings.Repeat("compress me ", 50) + `"}`
+	request := `{"id":"1"}`
+
+	tests := []struct {
+		name      string
+		indexed   string // -compress of JsonMock index
+		served    string // -compress of the server
+		encodings []string
+	}{
+		{"none indexed", "", "gzip", nil},
+		{"none served", "gzip,br", "", nil},
+		{"some served", "gzip,br", "br", []string{"br"}},
+		{"served order", "gzip,br", "br,gzip", []string{"br", "gzip"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "fixtures.idx")
+			if err := setResponseEncodings(test.indexed); err != nil {
+				t.Fatal(err)
+			}
+			writer, err := newIndexWriter(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer.add(mapKey("page=1", request), QueryResponse{query: "page=1", response: response})
+			writer.add(mapKey("", `{"id":"2"}`), QueryResponse{response: `{"short":1}`})
+			if err := writer.close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := setResponseEncodings(test.served); err != nil {
+				t.Fatal(err)
+			}
+			store, err := openDiskStore(file, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry := store.lookup("page=1", []byte(request))
+			if entry == nil {
+				t.Fatal("fixture must be found")
+			}
+			if string(entry.response) != response || entry.query != "page=1" {
+				t.Errorf("response %s, query %s", entry.response, entry.query)
+			}
+			var encodings []string
+			for _, variant := range entry.encoded {
+				encodings = append(encodings, variant.encoding[0])
+				if variant.encoding[0] == "gzip" {
+					reader, err := gzip.NewReader(bytes.NewReader(variant.body))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if plain, _ := ioutil.ReadAll(reader); string(plain) != response {
+						t.Errorf("gzip variant is %s", plain)
+					}
+				}
+			}
+			if !reflect.DeepEqual(encodings, test.encodings) {
+				t.Errorf("variants %v, want %v", encodings, test.encodings)
+			}
+			if entry := store.lookup("", []byte(`{"id":"2"}`)); entry == nil || len(entry.encoded) != 0 {
+				t.Errorf("short response must be found, never compressed: %+v", entry)
+			}
+			if store.lookup("page=2", []byte(request)) != nil {
+				t.Error("another query must not be found")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// fixture as other tools need it, query and request apart
+type exportedEntry struct {
+	query    string
+	request  string
+	response string
+}
+
+// every supported target format, writing the whole set of entries
+var exporters = map[string]func(entries []exportedEntry, name string) ([]byte, error){
+	"pact":    exportPact,
+	"postman": exportPostman,
+}
+
+// converts mapping files into other tools files: JsonMock export -format=postman -map=... -out=...
+func exportCommand(args []string) int {
+
+	format := "postman"
+	out := ""
+	name := "JsonMock"
+	mockRequestResponseFiles := mapFlag{files: []string{dataFilePath(MockRequestResponseFile)}}
+	requestJsonSchemaFile := dataFilePath(RequestJsonSchemaFile)
+	responseJsonSchemaFile := dataFilePath(ResponseJsonSchemaFile)
+
+	flags := commandFlags("export")
+	flags.StringVar(&format, "format", format, "Target format: "+strings.Join(exporterNames(), ", ")+".")
+	flags.StringVar(&out, "out", out, "File to write. By default the standard output.")
+	flags.StringVar(&name, "name", name, "Name of the exported collection, or consumer of the contract.")
+	flags.StringVar(&PactProvider, "provider", PactProvider, "Provider of the exported pact contract.")
+	flags.StringVar(&PactPath, "path", PactPath, "Request path of the exported pact interactions.")
+	flags.Var(&mockRequestResponseFiles, "map", "Fake mapped request/response file, directory or glob. Can be repeated.")
+	flags.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Json Schema to validate requests.")
+	flags.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Json Schema to validate responses.")
+	flags.Parse(args)
+
+	exporter, ok := exporters[format]
+	if !ok {
+		flags.Usage()
+		return 2
+	}
+
+	// only what the mock would answer
+	reqresmap, _, err := loadMockRequestResponseFiles(mockRequestResponseFiles.files, requestJsonSchemaFile, responseJsonSchemaFile, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	data, err := exporter(exportedEntries(reqresmap), name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to export: "+err.Error())
+		return 1
+	}
+	if len(out) == 0 {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to write "+out+": "+err.Error())
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d entries exported\n", out, reqresmap.Len())
+	return 0
+}
+
+func exporterNames() []string {
+	var names []string
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// entries ordered by key, so exports don't change between runs
+func exportedEntries(reqresmap *RequestResponseMap) []exportedEntry {
+	keys := make([]string, 0, reqresmap.Len())
+	entries := make([]exportedEntry, 0, reqresmap.Len())
+	reqresmap.Range(func(key string, value QueryResponse) {
+		request := key
+		if len(value.query) > 0 {
+			request = strings.TrimPrefix(key, "["+value.query+"]")
+		}
+		keys = append(keys, key)
+		entries = append(entries, exportedEntry{query: value.query, request: request, response: value.response})
+	})
+	sort.Sort(entriesByKey{keys, entries})
+	return entries
+}
+
+// same order as the keys
+type entriesByKey struct {
+	keys    []string
+	entries []exportedEntry
+}
+
+func (e entriesByKey) Len() int           { return len(e.keys) }
+func (e entriesByKey) Less(i, j int) bool { return e.keys[i] < e.keys[j] }
+func (e entriesByKey) Swap(i, j int) {
+	e.keys[i], e.keys[j] = e.keys[j], e.keys[i]
+	e.entries[i], e.entries[j] = e.entries[j], e.entries[i]
+}
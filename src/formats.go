@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// extensions of the supported mapping file formats, detected by extension
+var MockFileExtensions = []string{".json", ".yaml", ".yml", ".jsonl", ".ndjson"}
+
+// where an entry starts at its original file
+type filePosition struct {
+	line   int
+	column int
+}
+
+// read any mapping file converted into the json array format; positions are only provided when converted
+func readMockFile(mockRequestResponseFile string) ([]byte, []filePosition, error) {
+
+	data, err := ioutil.ReadFile(mockRequestResponseFile)
+	if err != nil {
+		return data, nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(mockRequestResponseFile)) {
+	case ".yaml", ".yml":
+		return yamlToJsonArray(data)
+	case ".jsonl", ".ndjson":
+		return jsonLinesToJsonArray(data)
+	default:
+		return data, nil, nil
+	}
+}
+
+// every non blank line is one entry
+func jsonLinesToJsonArray(data []byte) ([]byte, []filePosition, error) {
+
+	var positions []filePosition
+	array := bytes.NewBufferString("[")
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		entry := bytes.TrimSpace(scanner.Bytes())
+		if len(entry) == 0 {
+			continue
+		}
+		var raw json.RawMessage
+		if err := json.Unmarshal(entry, &raw); err != nil {
+			return nil, positions, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(positions) > 0 {
+			array.WriteString(",\n")
+		}
+		array.Write(entry)
+		positions = append(positions, filePosition{line: line, column: 1 + bytes.Index(scanner.Bytes(), entry[:1])})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, positions, err
+	}
+	array.WriteString("]")
+	return array.Bytes(), positions, nil
+}
+
+// yaml sequence of entries, keeping the order of the keys because requests are compared as they are written
+func yamlToJsonArray(data []byte) ([]byte, []filePosition, error) {
+
+	var positions []filePosition
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, positions, err
+	}
+	if len(document.Content) == 0 {
+		return []byte("[]"), positions, nil
+	}
+
+	root := document.Content[0]
+	if root.Kind == yaml.SequenceNode {
+		for _, entry := range root.Content {
+			positions = append(positions, filePosition{line: entry.Line, column: entry.Column})
+		}
+	}
+
+	array := new(bytes.Buffer)
+	if err := writeYamlAsJson(array, root); err != nil {
+		return nil, positions, err
+	}
+	return array.Bytes(), positions, nil
+}
+
+// yaml node to json, as it is written
+func writeYamlAsJson(out *bytes.Buffer, node *yaml.Node) error {
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			out.WriteString("null")
+			return nil
+		}
+		return writeYamlAsJson(out, node.Content[0])
+	case yaml.AliasNode:
+		return writeYamlAsJson(out, node.Alias)
+	case yaml.SequenceNode:
+		out.WriteString("[")
+		for i, item := range node.Content {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			if err := writeYamlAsJson(out, item); err != nil {
+				return err
+			}
+		}
+		out.WriteString("]")
+	case yaml.MappingNode:
+		out.WriteString("{")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			key, err := marshalAsWritten(node.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			out.Write(key)
+			out.WriteString(":")
+			if err := writeYamlAsJson(out, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		out.WriteString("}")
+	case yaml.ScalarNode:
+		var value interface{}
+		switch node.ShortTag() {
+		case "!!timestamp":
+			// kept as written, a json file would have it as a string too
+			value = node.Value
+		default:
+			if err := node.Decode(&value); err != nil {
+				return fmt.Errorf("line %d: %v", node.Line, err)
+			}
+		}
+		if number, ok := value.(float64); ok && (math.IsInf(number, 0) || math.IsNaN(number)) {
+			return fmt.Errorf("line %d: %s is not a json number", node.Line, node.Value)
+		}
+		scalar, err := marshalAsWritten(value)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		out.Write(scalar)
+	default:
+		return fmt.Errorf("line %d: unsupported yaml node", node.Line)
+	}
+	return nil
+}
+
+// json.Marshal escapes html characters, but requests are compared as they are written
+func marshalAsWritten(value interface{}) ([]byte, error) {
+	out := new(bytes.Buffer)
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(out.Bytes(), "\n"), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJsonLinesToJsonArray(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		data      string
+		array     string
+		positions []filePosition
+		err       bool
+	}{
+		{"empty", "", "[]", nil, false},
+		{"blank lines", "\n  \n", "[]", nil, false},
+		{"entries", `{"req":{"id":"1"},"res":{}}` + "\n\n" + `  {"req":{"id":"2"},"res":{}}` + "\r\n",
+			"[" + `{"req":{"id":"1"},"res":{}}` + ",\n" + `{"req":{"id":"2"},"res":{}}` + "]",
+			[]filePosition{{1, 1}, {3, 3}}, false},
+		{"no trailing newline", `{"a":1}`, `[{"a":1}]`, []filePosition{{1, 1}}, false},
+		{"broken line", "{\"a\":1}\n{\"a\":\n", "", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			array, positions, err := jsonLinesToJsonArray([]byte(test.data))
+			if (err != nil) != test.err {
+				t.Fatalf("error %v", err)
+			}
+			if test.err {
+				return
+			}
+			if string(array) != test.array {
+				t.Errorf("array %s, want %s", array, test.array)
+			}
+			if !reflect.DeepEqual(positions, test.positions) {
+				t.Errorf("positions %v, want %v", positions, test.positions)
+			}
+		})
+	}
+}
+
+func TestYamlToJsonArray(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		data      string
+		array     string
+		positions []filePosition
+		err       bool
+	}{
+		{"empty", "", "[]", nil, false},
+		{"keys as written", "- req: {z: 1, a: \"<b>\"}\n  res: {ok: true, n: null}\n",
+			`[{"req":{"z":1,"a":"<b>"},"res":{"ok":true,"n":null}}]`, []filePosition{{1, 3}}, false},
+		{"comments and block style", "# fixtures\n- query: a=1\n  req:\n    id: \"6\"\n  res:\n    list: [1, 2.5]\n\n-   req: {}\n    res: {}\n",
+			`[{"query":"a=1","req":{"id":"6"},"res":{"list":[1,2.5]}},{"req":{},"res":{}}]`, []filePosition{{2, 3}, {8, 5}}, false},
+		{"anchors", "- req: &r {id: \"1\"}\n  res: *r\n", `[{"req":{"id":"1"},"res":{"id":"1"}}]`, []filePosition{{1, 3}}, false},
+		{"timestamps as written", "- req: {day: 2024-01-02, at: 2024-01-02T10:00:00+02:00}\n  res: {}\n",
+			`[{"req":{"day":"2024-01-02","at":"2024-01-02T10:00:00+02:00"},"res":{}}]`, []filePosition{{1, 3}}, false},
+		{"infinite", "- req: {n: .inf}\n  res: {}\n", "", nil, true},
+		{"not a number", "- req: {}\n  res: {n: .nan}\n", "", nil, true},
+		{"broken", "- req: {id: \"1\"\n", "", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			array, positions, err := yamlToJsonArray([]byte(test.data))
+			if (err != nil) != test.err {
+				t.Fatalf("error %v", err)
+			}
+			if test.err {
+				return
+			}
+			if string(array) != test.array {
+				t.Errorf("array %s, want %s", array, test.array)
+			}
+			if !reflect.DeepEqual(positions, test.positions) {
+				t.Errorf("positions %v, want %v", positions, test.positions)
+			}
+		})
+	}
+}
+
+func TestMockEntryFormats(t *testing.T) {
+
+	// the same fixtures whatever the format
+	tests := []struct {
+		file    string
+		content string
+	}{
+		{"map.json", `[{"query":"b=2&a=1","req":{"id":"1"},"res":{"id":"1"}},{"req":{"id":"2"},"res":{"id":"2","day":"2024-01-02"}}]`},
+		{"map.jsonl", "{\"query\":\"b=2&a=1\",\"req\":{\"id\":\"1\"},\"res\":{\"id\":\"1\"}}\n{\"req\":{\"id\":\"2\"},\"res\":{\"id\":\"2\",\"day\":\"2024-01-02\"}}\n"},
+		{"map.ndjson", "{\"query\":\"b=2&a=1\",\"req\":{\"id\":\"1\"},\"res\":{\"id\":\"1\"}}\n{\"req\":{\"id\":\"2\"},\"res\":{\"id\":\"2\",\"day\":\"2024-01-02\"}}\n"},
+		{"map.yaml", "- query: b=2&a=1\n  req: {id: \"1\"}\n  res: {id: \"1\"}\n- req: {id: \"2\"}\n  res: {id: \"2\", day: 2024-01-02}\n"},
+		{"map.yml", "- {query: b=2&a=1, req: {id: \"1\"}, res: {id: \"1\"}}\n- {req: {id: \"2\"}, res: {id: \"2\", day: 2024-01-02}}\n"},
+	}
+	want := []string{`a=1&b=2 {"id":"1"} {"id":"1"}`, ` {"id":"2"} {"id":"2","day":"2024-01-02"}`}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			var got []string
+			err := forEachMockEntry(writeTestFile(t, test.file, test.content), nil, func(query string, request string, response string) {
+				got = append(got, query+" "+request+" "+response)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("entries %q, want %q", got, want)
+			}
+		})
+	}
+}
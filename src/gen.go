@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemas nested deeper than that are taken as endless recursive $ref
+const maxGeneratedDepth = 16
+
+// fixtures made up from the Json Schemas: JsonMock gen -req=... -res=... -count=... -out=...
+func genCommand(args []string) int {
+
+	count := 10
+	seed := int64(1)
+	out := dataFilePath("generatedMap.json")
+	requestJsonSchemaFile := dataFilePath(RequestJsonSchemaFile)
+	responseJsonSchemaFile := dataFilePath(ResponseJsonSchemaFile)
+
+	flags := commandFlags("gen")
+	flags.IntVar(&count, "count", count, "Fixtures to make up.")
+	flags.Int64Var(&seed, "seed", seed, "Seed of the made up values, the same one makes the same fixtures.")
+	flags.StringVar(&out, "out", out, "Mapping file to write; its extension decides its format.")
+	flags.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Json Schema of the requests to make up.")
+	flags.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Json Schema of the responses to make up.")
+	flags.Parse(args)
+
+	random := rand.New(rand.NewSource(seed))
+	requests, err := newSchemaGenerator(requestJsonSchemaFile, random)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	responses, err := newSchemaGenerator(responseJsonSchemaFile, random)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var candidates []importedEntry
+	for i := 0; i < count; i++ {
+		request, err := requests.generate()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to make up a request: "+err.Error())
+			return 1
+		}
+		response, err := responses.generate()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to make up a response: "+err.Error())
+			return 1
+		}
+		candidates = append(candidates, importedEntry{origin: "fixture " + strconv.Itoa(i), request: request, response: response})
+	}
+
+	// whatever the generator can't honour, like patterns, is left out by the same checks as imported entries
+	entries, rejected, err := validateImportedEntries(candidates, requestJsonSchemaFile, responseJsonSchemaFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, reason := range rejected {
+		fmt.Println("rejected " + reason)
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "Unable to make up any valid entry")
+		return 1
+	}
+
+	if err := writeMockFile(out, entries); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to write "+out+": "+err.Error())
+		return 1
+	}
+	fmt.Printf("%s: %d entries made up, %d rejected\n", out, len(entries), len(rejected))
+	return 0
+}
+
+// made up documents complying with a schema file, $ref to sibling files included
+type schemaGenerator struct {
+	file      string
+	documents map[string]interface{} // every schema file read so far
+	random    *rand.Rand
+}
+
+func newSchemaGenerator(file string, random *rand.Rand) (*schemaGenerator, error) {
+	g := &schemaGenerator{file: file, documents: make(map[string]interface{}), random: random}
+	if _, err := g.document(file); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *schemaGenerator) document(file string) (interface{}, error) {
+	if document, ok := g.documents[file]; ok {
+		return document, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New("Unable to read Json Schema: " + err.Error())
+	}
+	var document interface{}
+	if err := decodeNumbers(data, &document); err != nil {
+		return nil, errors.New("Unable to process Json Schema " + file + ": " + err.Error())
+	}
+	g.documents[file] = document
+	return document, nil
+}
+
+func (g *schemaGenerator) generate() ([]byte, error) {
+	value, err := g.value(g.file, g.documents[g.file], 0)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// value complying with a schema of file
+func (g *schemaGenerator) value(file string, schema interface{}, depth int) (interface{}, error) {
+
+	if depth > maxGeneratedDepth {
+		return nil, errors.New("schema nested too deep at " + file + ", recursive $ref?")
+	}
+	// true accepts anything, false nothing at all
+	object, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	if ref, ok := object["$ref"].(string); ok {
+		refFile, target, err := g.resolve(file, ref)
+		if err != nil {
+			return nil, err
+		}
+		return g.value(refFile, target, depth+1)
+	}
+	if value, ok := object["const"]; ok {
+		return value, nil
+	}
+	for _, keyword := range []string{"enum", "examples"} {
+		if values, ok := object[keyword].([]interface{}); ok && len(values) > 0 {
+			return values[g.random.Intn(len(values))], nil
+		}
+	}
+	if parts, ok := object["allOf"].([]interface{}); ok {
+		merged, err := g.merge(file, object, parts)
+		if err != nil {
+			return nil, err
+		}
+		return g.value(file, merged, depth+1)
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		if options, ok := object[keyword].([]interface{}); ok && len(options) > 0 {
+			return g.value(file, options[g.random.Intn(len(options))], depth+1)
+		}
+	}
+
+	switch g.schemaType(object) {
+	case "object":
+		return g.object(file, object, depth)
+	case "array":
+		return g.array(file, object, depth)
+	case "integer":
+		return g.integer(file, object)
+	case "number":
+		return g.number(file, object)
+	case "boolean":
+		return g.random.Intn(2) == 0, nil
+	case "null":
+		return nil, nil
+	}
+	return g.string(object), nil
+}
+
+// declared type, one of them when several; guessed by its keywords otherwise
+func (g *schemaGenerator) schemaType(object map[string]interface{}) string {
+	switch kind := object["type"].(type) {
+	case string:
+		return kind
+	case []interface{}:
+		var kinds []string
+		for _, k := range kind {
+			if name, ok := k.(string); ok && name != "null" {
+				kinds = append(kinds, name)
+			}
+		}
+		if len(kinds) == 0 {
+			return "null"
+		}
+		return kinds[g.random.Intn(len(kinds))]
+	}
+	for kind, keywords := range map[string][]string{
+		"object": {"properties", "required", "additionalProperties"},
+		"array":  {"items", "prefixItems", "minItems", "maxItems"},
+		"number": {"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf"},
+	} {
+		for _, keyword := range keywords {
+			if _, ok := object[keyword]; ok {
+				return kind
+			}
+		}
+	}
+	return "string"
+}
+
+// required properties always, optional ones now and then
+func (g *schemaGenerator) object(file string, object map[string]interface{}, depth int) (interface{}, error) {
+
+	properties, _ := object["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if names, ok := object["required"].([]interface{}); ok {
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+
+	// same seed, same fixtures: names in order
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	for name := range required {
+		if _, ok := properties[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := make(map[string]interface{})
+	for _, name := range names {
+		if !required[name] && g.random.Intn(2) == 0 {
+			continue
+		}
+		schema, ok := properties[name]
+		if !ok {
+			schema = object["additionalProperties"]
+		}
+		value, err := g.value(file, schema, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+func (g *schemaGenerator) array(file string, object map[string]interface{}, depth int) (interface{}, error) {
+
+	// tuples: draft-07 items array or 2020-12 prefixItems
+	tuple, ok := object["prefixItems"].([]interface{})
+	if !ok {
+		tuple, _ = object["items"].([]interface{})
+	}
+	if tuple != nil {
+		var result []interface{}
+		for _, schema := range tuple {
+			value, err := g.value(file, schema, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+		return result, nil
+	}
+
+	min := 1
+	if value, ok := numberKeyword(object, "minItems"); ok {
+		min = int(value)
+	}
+	max := min + 2
+	if value, ok := numberKeyword(object, "maxItems"); ok && int(value) < max {
+		max = int(value)
+	}
+	if max < min {
+		max = min
+	}
+	result := []interface{}{}
+	for n := min + g.random.Intn(max-min+1); n > 0; n-- {
+		value, err := g.value(file, object["items"], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// formats asserted by the validator, words otherwise; patterns are not honoured
+func (g *schemaGenerator) string(object map[string]interface{}) interface{} {
+
+	r := g.random
+	moment := time.Date(2020+r.Intn(6), time.Month(1+r.Intn(12)), 1+r.Intn(28), r.Intn(24), r.Intn(60), r.Intn(60), 0, time.UTC)
+	switch object["format"] {
+	case "date-time":
+		return moment.Format(time.RFC3339)
+	case "date":
+		return moment.Format("2006-01-02")
+	case "time":
+		return moment.Format("15:04:05Z")
+	case "duration":
+		return "P" + strconv.Itoa(1+r.Intn(30)) + "D"
+	case "uuid":
+		return fmt.Sprintf("%08x-%04x-4%03x-%04x-%012x", r.Uint32(), r.Intn(0x10000), r.Intn(0x1000), 0x8000|r.Intn(0x4000), r.Int63n(1<<48))
+	case "email":
+		return g.word(6) + "@example.com"
+	case "hostname":
+		return g.word(6) + ".example.com"
+	case "ipv4":
+		return fmt.Sprintf("10.%d.%d.%d", r.Intn(256), r.Intn(256), 1+r.Intn(254))
+	case "ipv6":
+		return fmt.Sprintf("2001:db8::%x", 1+r.Intn(0xffff))
+	case "uri":
+		return "https://example.com/" + url.PathEscape(g.word(8))
+	}
+
+	length := 8
+	if value, ok := numberKeyword(object, "minLength"); ok && int(value) > length {
+		length = int(value)
+	}
+	if value, ok := numberKeyword(object, "maxLength"); ok && int(value) < length {
+		length = int(value)
+	}
+	return g.word(length)
+}
+
+func (g *schemaGenerator) word(length int) string {
+	letters := make([]byte, length)
+	for i := range letters {
+		letters[i] = byte('a' + g.random.Intn(26))
+	}
+	return string(letters)
+}
+
+func (g *schemaGenerator) integer(file string, object map[string]interface{}) (interface{}, error) {
+	min, max := numberRange(object)
+	low, high := math.Ceil(min), math.Floor(max)
+	step := 1.0
+	if multipleOf, ok := numberKeyword(object, "multipleOf"); ok && multipleOf > 0 {
+		// integers multiple of a fractional step are the multiples of its first integer multiple
+		if step = integerStep(multipleOf); step == 0 {
+			return nil, fmt.Errorf("no integer multiple of %v at %s", multipleOf, file)
+		}
+	}
+	first, last := math.Ceil(low/step)*step, math.Floor(high/step)*step
+	if first > last {
+		return nil, fmt.Errorf("no integer multiple of %v between %v and %v at %s", step, min, max, file)
+	}
+	return int64(first) + int64(step)*g.random.Int63n(int64((last-first)/step)+1), nil
+}
+
+// smallest integer multiple of step, 0 when none of its first thousand multiples is
+func integerStep(step float64) float64 {
+	for n := 1.0; n <= 1000; n++ {
+		if multiple := n * step; math.Abs(multiple-math.Round(multiple)) < 1e-9 {
+			return math.Round(multiple)
+		}
+	}
+	return 0
+}
+
+func (g *schemaGenerator) number(file string, object map[string]interface{}) (interface{}, error) {
+	min, max := numberRange(object)
+	if step, ok := numberKeyword(object, "multipleOf"); ok && step > 0 {
+		first, last := math.Ceil(min/step), math.Floor(max/step)
+		if first > last {
+			return nil, fmt.Errorf("no multiple of %v between %v and %v at %s", step, min, max, file)
+		}
+		return (first + float64(g.random.Int63n(int64(last-first)+1))) * step, nil
+	}
+	value := min + g.random.Float64()*(max-min)
+	// two decimals, but never out of range because of rounding
+	if rounded := math.Round(value*100) / 100; rounded >= min && rounded <= max {
+		return rounded, nil
+	}
+	return value, nil
+}
+
+// bounds of a number, exclusive ones as draft-04 booleans or later drafts numbers; those are moved to the closest value inside,
+// so numbers stay in the open interval and integers are rounded into it
+func numberRange(object map[string]interface{}) (float64, float64) {
+	min, hasMin := numberKeyword(object, "minimum")
+	max, hasMax := numberKeyword(object, "maximum")
+	if value, ok := numberKeyword(object, "exclusiveMinimum"); ok {
+		min, hasMin = math.Nextafter(value, math.Inf(1)), true
+	} else if exclusive, _ := object["exclusiveMinimum"].(bool); exclusive && hasMin {
+		min = math.Nextafter(min, math.Inf(1))
+	}
+	if value, ok := numberKeyword(object, "exclusiveMaximum"); ok {
+		max, hasMax = math.Nextafter(value, math.Inf(-1)), true
+	} else if exclusive, _ := object["exclusiveMaximum"].(bool); exclusive && hasMax {
+		max = math.Nextafter(max, math.Inf(-1))
+	}
+	switch {
+	case !hasMin && !hasMax:
+		min, max = 0, 1000
+	case !hasMin:
+		min = max - 1000
+	case !hasMax:
+		max = min + 1000
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+func numberKeyword(object map[string]interface{}, keyword string) (float64, bool) {
+	number, ok := object[keyword].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	value, err := number.Float64()
+	return value, err == nil
+}
+
+// every part of an allOf as a single schema: properties and required merged, the first one wins for the rest
+func (g *schemaGenerator) merge(file string, object map[string]interface{}, parts []interface{}) (map[string]interface{}, error) {
+
+	merged := make(map[string]interface{})
+	properties := make(map[string]interface{})
+	var required []interface{}
+	add := func(schema map[string]interface{}) {
+		for keyword, value := range schema {
+			switch keyword {
+			case "allOf":
+			case "properties":
+				if more, ok := value.(map[string]interface{}); ok {
+					for name, property := range more {
+						properties[name] = property
+					}
+				}
+			case "required":
+				if more, ok := value.([]interface{}); ok {
+					required = append(required, more...)
+				}
+			default:
+				if _, ok := merged[keyword]; !ok {
+					merged[keyword] = value
+				}
+			}
+		}
+	}
+
+	add(object)
+	for _, part := range parts {
+		schema, _ := part.(map[string]interface{})
+		for depth := 0; schema != nil && schema["$ref"] != nil; depth++ {
+			ref, _ := schema["$ref"].(string)
+			if depth > maxGeneratedDepth {
+				return nil, errors.New("Unable to resolve $ref " + ref + " at " + file + ": recursive")
+			}
+			_, target, err := g.resolve(file, ref)
+			if err != nil {
+				return nil, err
+			}
+			schema, _ = target.(map[string]interface{})
+		}
+		if schema != nil {
+			add(schema)
+		}
+	}
+	if len(properties) > 0 {
+		merged["properties"] = properties
+	}
+	if len(required) > 0 {
+		merged["required"] = required
+	}
+	return merged, nil
+}
+
+// schema a $ref points to, at the same file or at a sibling one, and the file it is at
+func (g *schemaGenerator) resolve(file string, ref string) (string, interface{}, error) {
+
+	path, fragment := ref, ""
+	if i := strings.IndexByte(ref, '#'); i >= 0 {
+		path, fragment = ref[:i], ref[i+1:]
+	}
+	if strings.Contains(path, "://") {
+		return "", nil, errors.New("Unable to resolve $ref " + ref + " at " + file + ": only local files")
+	}
+	if len(path) > 0 {
+		file = relativeToFile(file, path)
+	}
+	target, err := g.document(file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// json pointer
+	if len(fragment) > 0 && !strings.HasPrefix(fragment, "/") {
+		return "", nil, errors.New("Unable to resolve $ref " + ref + " at " + file + ": only json pointers")
+	}
+	for _, token := range strings.Split(fragment, "/")[1:] {
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		found := false
+		switch node := target.(type) {
+		case map[string]interface{}:
+			target, found = node[token]
+		case []interface{}:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node) {
+				target, found = node[i], true
+			}
+		}
+		if !found {
+			return "", nil, errors.New("Unable to resolve $ref " + ref + " at " + file)
+		}
+	}
+	return file, target, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGenerateValueRanges(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		schema string
+		err    bool // nothing complies with it
+	}{
+		{"integer", `{"type":"integer","minimum":-5,"maximum":5}`, false},
+		{"integer only minimum", `{"type":"integer","minimum":100000}`, false},
+		{"integer multiple", `{"type":"integer","minimum":1,"maximum":20,"multipleOf":7}`, false},
+		{"integer fractional multiple", `{"type":"integer","maximum":12,"multipleOf":2.5}`, false},
+		{"integer exclusive", `{"type":"integer","exclusiveMinimum":1,"exclusiveMaximum":4}`, false},
+		{"integer draft-04 exclusive", `{"$schema":"http://json-schema.org/draft-04/schema#","type":"integer","minimum":1,"exclusiveMinimum":true,"maximum":3,"exclusiveMaximum":true}`, false},
+		{"number", `{"type":"number","minimum":0.5,"maximum":0.75}`, false},
+		{"integer fractional exclusive", `{"type":"integer","exclusiveMinimum":1.5,"exclusiveMaximum":3}`, false},
+		{"number exclusive", `{"type":"number","exclusiveMinimum":0,"exclusiveMaximum":1}`, false},
+		{"number narrow exclusive", `{"type":"number","exclusiveMinimum":0.5,"exclusiveMaximum":0.51}`, false},
+		{"number draft-04 exclusive", `{"$schema":"http://json-schema.org/draft-04/schema#","type":"number","minimum":0,"exclusiveMinimum":true,"maximum":0.01,"exclusiveMaximum":true}`, false},
+		{"number exclusive multiple", `{"type":"number","exclusiveMinimum":0,"exclusiveMaximum":1,"multipleOf":0.5}`, false},
+		{"number multiple", `{"type":"number","minimum":0.1,"maximum":0.9,"multipleOf":0.25}`, false},
+		{"guessed number", `{"multipleOf":3,"maximum":10}`, false},
+		{"object", `{"type":"object","required":["id","n"],"properties":{"id":{"type":"string","minLength":3,"maxLength":5},"n":{"type":"integer","minimum":1,"maximum":2}}}`, false},
+		{"no integer multiple", `{"type":"integer","minimum":8,"maximum":13,"multipleOf":7}`, true},
+		{"no integer", `{"type":"integer","minimum":1.2,"maximum":1.5}`, true},
+		{"no number multiple", `{"type":"number","minimum":1,"maximum":9,"multipleOf":10}`, true},
+		{"no exclusive number multiple", `{"type":"number","exclusiveMinimum":0,"exclusiveMaximum":1,"multipleOf":1}`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeTestFile(t, "schema.json", test.schema)
+			schema, err := loadSchemaFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, err := newSchemaGenerator(file, rand.New(rand.NewSource(1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 200; i++ {
+				value, err := g.generate()
+				if test.err {
+					if err == nil {
+						t.Fatalf("%s generated, nothing complies", value)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if violations := schemaErrors(schema, string(value)); len(violations) > 0 {
+					t.Fatalf("%s generated: %v", value, violations)
+				}
+			}
+		})
+	}
+}
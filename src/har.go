@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// only the HAR 1.2 fields needed to build fixtures
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method      string `json:"method"`
+		URL         string `json:"url"`
+		QueryString []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"queryString"`
+		PostData *struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status  int `json:"status"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// HAR entries exchanging json bodies, as browsers and proxies save them
+func importHar(data []byte) ([]importedEntry, []string, error) {
+
+	var entries []importedEntry
+	var skipped []string
+
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return entries, skipped, err
+	}
+
+	debugRegexp := regexp.MustCompile("^" + DebugParameter + "")
+	for i, entry := range har.Log.Entries {
+		origin := "entry " + strconv.Itoa(i+1) + " " + entry.Request.Method + " " + entry.Request.URL
+
+		if entry.Response.Status != http.StatusOK {
+			skipped = append(skipped, origin+": status "+strconv.Itoa(entry.Response.Status))
+			continue
+		}
+		// GET and friends: an empty request, as body-less requests are looked up
+		request := []byte(emptyRequest)
+		if entry.Request.PostData != nil && len(strings.TrimSpace(entry.Request.PostData.Text)) > 0 {
+			if !isJsonMimeType(entry.Request.PostData.MimeType) {
+				skipped = append(skipped, origin+": request without json body")
+				continue
+			}
+			request = []byte(entry.Request.PostData.Text)
+		}
+		if !isJsonMimeType(entry.Response.Content.MimeType) {
+			skipped = append(skipped, origin+": response without json body")
+			continue
+		}
+
+		response := []byte(entry.Response.Content.Text)
+		if entry.Response.Content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+			if err != nil {
+				skipped = append(skipped, origin+": response "+err.Error())
+				continue
+			}
+			response = decoded
+		}
+
+		// queryString is the parsed form; the url is the fallback when missing
+		values := url.Values{}
+		for _, param := range entry.Request.QueryString {
+			values.Add(param.Name, param.Value)
+		}
+		if len(values) == 0 {
+			if u, err := url.Parse(entry.Request.URL); err == nil {
+				values = u.Query()
+			}
+		}
+
+		entries = append(entries, importedEntry{
+			origin:   origin,
+			query:    orderQueryByParams(QueryValuesAsString(values), debugRegexp),
+			request:  request,
+			response: response,
+		})
+	}
+	return entries, skipped, nil
+}
+
+// application/json, application/problem+json, with or without charset
+func isJsonMimeType(mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	return mimeType == "application/json" || strings.HasSuffix(mimeType, "+json")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testHar = `{"log":{"entries":[
+{"request":{"method":"POST","url":"http://api/x?b=2&a=1","queryString":[{"name":"b","value":"2"},{"name":"a","value":"1"}],
+  "postData":{"mimeType":"application/json","text":"{ \"id\": \"1\" }"}},
+ "response":{"status":200,"content":{"mimeType":"application/json; charset=utf-8","text":"{\"id\":\"1\"}"}}},
+{"request":{"method":"GET","url":"http://api/x?id=2"},
+ "response":{"status":200,"content":{"mimeType":"application/json","text":"eyJpZCI6IjIifQ==","encoding":"base64"}}},
+{"request":{"method":"POST","url":"http://api/x","postData":{"mimeType":"text/plain","text":"id=3"}},
+ "response":{"status":200,"content":{"mimeType":"application/json","text":"{}"}}},
+{"request":{"method":"GET","url":"http://api/x"},
+ "response":{"status":404,"content":{"mimeType":"application/json","text":"{}"}}},
+{"request":{"method":"GET","url":"http://api/x"},
+ "response":{"status":200,"content":{"mimeType":"text/html","text":"<html/>"}}}
+]}}`
+
+func TestImportHar(t *testing.T) {
+
+	entries, skipped, err := importHar([]byte(testHar))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []importedEntry{
+		{origin: "entry 1 POST http://api/x?b=2&a=1", query: "a=1&b=2", request: []byte(`{ "id": "1" }`), response: []byte(`{"id":"1"}`)},
+		{origin: "entry 2 GET http://api/x?id=2", query: "id=2", request: []byte(`{}`), response: []byte(`{"id":"2"}`)},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries\n%q\nwant\n%q", entries, want)
+	}
+	wantSkipped := []string{
+		"entry 3 POST http://api/x: request without json body",
+		"entry 4 GET http://api/x: status 404",
+		"entry 5 GET http://api/x: response without json body",
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("skipped\n%q\nwant\n%q", skipped, wantSkipped)
+	}
+}
+
+// imported entries validated, written and loaded as a mapping file, ready to be served
+func serveImported(t *testing.T, candidates []importedEntry) *customHandler {
+	t.Helper()
+	dir := t.TempDir()
+	req := writeTestFile(t, "req.json", `{"type":"object"}`)
+	res := writeTestFile(t, "res.json", `{"type":"object","required":["id"]}`)
+	entries, rejected, err := validateImportedEntries(candidates, req, res)
+	if err != nil || len(rejected) > 0 {
+		t.Fatal(err, rejected)
+	}
+	file := filepath.Join(dir, "imported.json")
+	if err := writeMockFile(file, entries); err != nil {
+		t.Fatal(err)
+	}
+	fixtures, reqSchema, err := loadMockRequestResponseFiles([]string{file}, req, res, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &customHandler{rrmap: fixtures, reqSchema: reqSchema}
+}
+
+// every request answered 200 with its response
+func assertServed(t *testing.T, handler http.Handler, tests []servedTest) {
+	t.Helper()
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.target, bytes.NewBufferString(test.body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != test.response {
+			t.Errorf("%s %s %s answered %d %s, want %s", test.method, test.target, test.body, w.Code, w.Body.String(), test.response)
+		}
+	}
+}
+
+type servedTest struct {
+	method   string
+	target   string
+	body     string
+	response string
+}
+
+func TestImportHarServed(t *testing.T) {
+
+	candidates, _, err := importHar([]byte(testHar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := serveImported(t, candidates)
+
+	assertServed(t, handler, []servedTest{
+		{"POST", "/x?b=2&a=1", `{"id":"1"}`, `{"id":"1"}`},
+		{"GET", "/x?id=2", "", `{"id":"2"}`},
+		{"GET", "/x?id=2", "{ }", `{"id":"2"}`},
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fixture candidate coming from another tool
+type importedEntry struct {
+	origin   string // where it comes from, to report rejections
+	query    string
+	request  []byte
+	response []byte
+}
+
+// every supported source format, reading its entries and the reasons why others were skipped
+var importers = map[string]func(data []byte) ([]importedEntry, []string, error){
+	"har":     importHar,
+	"pact":    importPact,
+	"postman": importPostman,
+}
+
+// converts other tools files into a mapping file: JsonMock import -format=har -in=... -out=...
+func importCommand(args []string) int {
+
+	format := "har"
+	in := ""
+	out := dataFilePath("importedMap.json")
+	requestJsonSchemaFile := dataFilePath(RequestJsonSchemaFile)
+	responseJsonSchemaFile := dataFilePath(ResponseJsonSchemaFile)
+	verbose := false
+
+	flags := commandFlags("import")
+	flags.StringVar(&format, "format", format, "Source format: "+strings.Join(importerNames(), ", ")+".")
+	flags.StringVar(&in, "in", in, "File to import.")
+	flags.StringVar(&out, "out", out, "Mapping file to write; its extension decides its format.")
+	flags.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Json Schema to validate requests.")
+	flags.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Json Schema to validate responses.")
+	flags.BoolVar(&verbose, "verbose", verbose, "Report skipped entries as well, not only rejected ones.")
+	flags.Parse(args)
+
+	importer, ok := importers[format]
+	if !ok || len(in) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	candidates, skipped, err := importer(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to import "+in+": "+err.Error())
+		return 1
+	}
+	if verbose {
+		for _, reason := range skipped {
+			fmt.Println("skipped " + reason)
+		}
+	}
+
+	entries, rejected, err := validateImportedEntries(candidates, requestJsonSchemaFile, responseJsonSchemaFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, reason := range rejected {
+		fmt.Println("rejected " + reason)
+	}
+
+	if err := writeMockFile(out, entries); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to write "+out+": "+err.Error())
+		return 1
+	}
+	fmt.Printf("%s: %d entries imported from %s, %d rejected, %d skipped\n", out, len(entries), in, len(rejected), len(skipped))
+	return 0
+}
+
+func importerNames() []string {
+	var names []string
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// same checks as the loader: json objects complying with their schemas, first one wins for every key
+func validateImportedEntries(candidates []importedEntry, requestJsonSchemaFile string, responseJsonSchemaFile string) ([][]byte, []string, error) {
+
+	var entries [][]byte
+	var rejected []string
+
+	reqSchema, err := loadSchemaFile(requestJsonSchemaFile)
+	if err != nil {
+		return entries, rejected, fmt.Errorf("Request Json Schema %s: %v", requestJsonSchemaFile, err)
+	}
+	resSchema, err := loadSchemaFile(responseJsonSchemaFile)
+	if err != nil {
+		return entries, rejected, fmt.Errorf("Response Json Schema %s: %v", responseJsonSchemaFile, err)
+	}
+
+	keys := make(map[string]string)
+	for _, candidate := range candidates {
+		request, err := compactObject(candidate.request)
+		if err != nil {
+			rejected = append(rejected, candidate.origin+": request is not a json object")
+			continue
+		}
+		response, err := compactObject(candidate.response)
+		if err != nil {
+			rejected = append(rejected, candidate.origin+": response is not a json object")
+			continue
+		}
+		if violations := schemaErrors(reqSchema, request); len(violations) > 0 {
+			rejected = append(rejected, candidate.origin+": request "+strings.Join(violations, "; "))
+			continue
+		}
+		if violations := schemaErrors(resSchema, response); len(violations) > 0 {
+			rejected = append(rejected, candidate.origin+": response "+strings.Join(violations, "; "))
+			continue
+		}
+		key := mapKey(candidate.query, request)
+		if first, ok := keys[key]; ok {
+			rejected = append(rejected, candidate.origin+": duplicated key, already imported from "+first)
+			continue
+		}
+		keys[key] = candidate.origin
+
+		entry, err := marshalMockEntry(candidate.query, request, response)
+		if err != nil {
+			rejected = append(rejected, candidate.origin+": "+err.Error())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rejected, nil
+}
+
+// whole mapping file in the format its extension decides, one entry per line
+func writeMockFile(file string, entries [][]byte) error {
+
+	out := new(bytes.Buffer)
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jsonl", ".ndjson":
+		for _, entry := range entries {
+			out.Write(entry)
+			out.WriteString("\n")
+		}
+	case ".yaml", ".yml":
+		for _, entry := range entries {
+			out.WriteString("- ")
+			out.Write(entry)
+			out.WriteString("\n")
+		}
+	default:
+		out.WriteString("[\n")
+		for i, entry := range entries {
+			out.Write(entry)
+			if i < len(entries)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString("]\n")
+	}
+	return ioutil.WriteFile(file, out.Bytes(), 0644)
+}
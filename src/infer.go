@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// InferEnumLimit different values of a string to be taken as an enum, when some of them are repeated
+var InferEnumLimit = 5
+
+// InferredSchemaDraft every inferred schema is declared as
+var InferredSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// infers request and response schemas from the fixtures: JsonMock infer -map=... -req=... -res=...
+func inferCommand(args []string) int {
+
+	mockRequestResponseFiles := mapFlag{files: []string{dataFilePath(MockRequestResponseFile)}}
+	requestJsonSchemaFile := dataFilePath("inferredRequestJsonSchema.json")
+	responseJsonSchemaFile := dataFilePath("inferredResponseJsonSchema.json")
+
+	flags := commandFlags("infer")
+	flags.Var(&mockRequestResponseFiles, "map", "Fake mapped request/response file, directory or glob. Can be repeated.")
+	flags.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Inferred Json Schema of the requests to write.")
+	flags.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Inferred Json Schema of the responses to write.")
+	flags.IntVar(&InferEnumLimit, "enum", InferEnumLimit, "Different values of a string to be taken as an enum. 0 for no enums.")
+	flags.Parse(args)
+
+	files, err := expandMapFiles(mockRequestResponseFiles.files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var requests, responses []interface{}
+	for _, file := range files {
+		err := forEachMockEntry(file, nil, func(query string, request string, response string) {
+			var req, res interface{}
+			if decodeNumbers([]byte(request), &req) == nil {
+				requests = append(requests, req)
+			}
+			if decodeNumbers([]byte(response), &res) == nil {
+				responses = append(responses, res)
+			}
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to infer from "+file+": "+err.Error())
+			return 1
+		}
+	}
+	if len(requests) == 0 {
+		fmt.Fprintln(os.Stderr, "Unable to find any entry at Mock Request Response Files")
+		return 1
+	}
+
+	for _, inferred := range []struct {
+		file    string
+		samples []interface{}
+	}{{requestJsonSchemaFile, requests}, {responseJsonSchemaFile, responses}} {
+		schema := inferSchema(inferred.samples)
+		schema["$schema"] = InferredSchemaDraft
+		out := new(bytes.Buffer)
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(schema); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := ioutil.WriteFile(inferred.file, out.Bytes(), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to write "+inferred.file+": "+err.Error())
+			return 1
+		}
+		fmt.Printf("%s: inferred from %d samples\n", inferred.file, len(inferred.samples))
+	}
+	return 0
+}
+
+// narrowest schema every sample complies with: types, required properties, small enums and number ranges
+func inferSchema(samples []interface{}) map[string]interface{} {
+
+	schema := make(map[string]interface{})
+	kinds := make(map[string]bool)
+	var objects []map[string]interface{}
+	var items []interface{}
+	var strs []string
+	var numbers []json.Number
+
+	for _, sample := range samples {
+		switch value := sample.(type) {
+		case nil:
+			kinds["null"] = true
+		case bool:
+			kinds["boolean"] = true
+		case string:
+			kinds["string"] = true
+			strs = append(strs, value)
+		case json.Number:
+			if strings.ContainsAny(value.String(), ".eE") {
+				kinds["number"] = true
+			} else {
+				kinds["integer"] = true
+			}
+			numbers = append(numbers, value)
+		case map[string]interface{}:
+			kinds["object"] = true
+			objects = append(objects, value)
+		case []interface{}:
+			kinds["array"] = true
+			items = append(items, value...)
+		}
+	}
+
+	// integers are numbers as well
+	if kinds["number"] {
+		delete(kinds, "integer")
+	}
+	var types []string
+	for kind := range kinds {
+		types = append(types, kind)
+	}
+	sort.Strings(types)
+	if len(types) == 1 {
+		schema["type"] = types[0]
+	} else if len(types) > 1 {
+		schema["type"] = types
+	}
+
+	if len(objects) > 0 {
+		properties := make(map[string]interface{})
+		present := make(map[string][]interface{})
+		for _, object := range objects {
+			for name, value := range object {
+				present[name] = append(present[name], value)
+			}
+		}
+		var required []string
+		for name, values := range present {
+			properties[name] = inferSchema(values)
+			if len(values) == len(objects) {
+				required = append(required, name)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+	}
+
+	if kinds["array"] && len(items) > 0 {
+		schema["items"] = inferSchema(items)
+	}
+
+	onlyStrings := len(kinds) == 1 || (len(kinds) == 2 && kinds["null"])
+	if len(strs) > 0 && onlyStrings && InferEnumLimit > 0 {
+		distinct := make(map[string]bool)
+		for _, str := range strs {
+			distinct[str] = true
+		}
+		// ids and alike are never repeated
+		if len(distinct) <= InferEnumLimit && len(distinct) < len(strs) {
+			var enum []interface{}
+			for str := range distinct {
+				enum = append(enum, str)
+			}
+			sort.Slice(enum, func(i, j int) bool { return enum[i].(string) < enum[j].(string) })
+			if kinds["null"] {
+				enum = append(enum, nil)
+			}
+			schema["enum"] = enum
+		}
+	}
+
+	if len(numbers) > 0 {
+		minimum, maximum := numbers[0], numbers[0]
+		for _, number := range numbers[1:] {
+			value, _ := number.Float64()
+			if low, _ := minimum.Float64(); value < low {
+				minimum = number
+			}
+			if high, _ := maximum.Float64(); value > high {
+				maximum = number
+			}
+		}
+		schema["minimum"] = minimum
+		schema["maximum"] = maximum
+	}
+
+	return schema
+}
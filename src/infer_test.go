@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestInferSchema(t *testing.T) {
+
+	defer func(limit int) { InferEnumLimit = limit }(InferEnumLimit)
+	InferEnumLimit = 5
+
+	tests := []struct {
+		name    string
+		samples []string
+		schema  string
+	}{
+		{"required and optional", []string{`{"id":"1","n":1}`, `{"id":"2"}`},
+			`{"properties":{"id":{"type":"string"},"n":{"maximum":1,"minimum":1,"type":"integer"}},"required":["id"],"type":"object"}`},
+		{"integers and numbers", []string{`1`, `-3`, `2.5`, `1e2`},
+			`{"maximum":1e2,"minimum":-3,"type":"number"}`},
+		{"big integers", []string{`12345678901234567890`, `1`},
+			`{"maximum":12345678901234567890,"minimum":1,"type":"integer"}`},
+		{"repeated strings", []string{`"cat"`, `"dog"`, `"cat"`},
+			`{"enum":["cat","dog"],"type":"string"}`},
+		{"distinct strings", []string{`"a1"`, `"b2"`, `"c3"`},
+			`{"type":"string"}`},
+		{"nullable strings", []string{`"cat"`, `null`, `"cat"`},
+			`{"enum":["cat",null],"type":["null","string"]}`},
+		{"mixed types", []string{`"a"`, `"a"`, `1`, `true`},
+			`{"maximum":1,"minimum":1,"type":["boolean","integer","string"]}`},
+		{"arrays", []string{`[{"a":1},{"a":2,"b":true}]`, `[]`},
+			`{"items":{"properties":{"a":{"maximum":2,"minimum":1,"type":"integer"},"b":{"type":"boolean"}},"required":["a"],"type":"object"},"type":"array"}`},
+		{"empty arrays", []string{`[]`},
+			`{"type":"array"}`},
+		{"nested objects", []string{`{"o":{"x":null}}`, `{"o":{"x":"1"}}`},
+			`{"properties":{"o":{"properties":{"x":{"type":["null","string"]}},"required":["x"],"type":"object"}},"required":["o"],"type":"object"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var samples []interface{}
+			for _, sample := range test.samples {
+				var value interface{}
+				if err := decodeNumbers([]byte(sample), &value); err != nil {
+					t.Fatal(err)
+				}
+				samples = append(samples, value)
+			}
+			inferred := inferSchema(samples)
+			schema, err := json.Marshal(inferred)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(schema) != test.schema {
+				t.Errorf("schema\n%s\nwant\n%s", schema, test.schema)
+			}
+
+			// every sample complies with it
+			compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sample := range test.samples {
+				if violations := schemaErrors(compiled, sample); len(violations) > 0 {
+					t.Errorf("%s breaks it: %v", sample, violations)
+				}
+			}
+		})
+	}
+}
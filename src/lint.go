@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fixtures that load fine but are likely mistakes: JsonMock lint -map=... -req=... -res=... -format=human|json
+func lintCommand(args []string) int {
+
+	mockRequestResponseFiles := mapFlag{files: []string{dataFilePath(MockRequestResponseFile)}}
+	requestJsonSchemaFile := dataFilePath(RequestJsonSchemaFile)
+	responseJsonSchemaFile := dataFilePath(ResponseJsonSchemaFile)
+	format := "human"
+
+	flags := commandFlags("lint")
+	flags.Var(&mockRequestResponseFiles, "map", "Fake mapped request/response file, directory or glob. Can be repeated.")
+	flags.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Json Schema to validate requests.")
+	flags.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Json Schema to validate responses.")
+	flags.StringVar(&format, "format", format, "Report format: human or json.")
+	flags.Parse(args)
+
+	if format != "human" && format != "json" {
+		fmt.Fprintln(os.Stderr, "Unknown -format "+format+". Use human or json.")
+		return 2
+	}
+
+	files, err := expandMapFiles(mockRequestResponseFiles.files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	reports := []ValidationReport{}
+	schemas := []string{requestJsonSchemaFile, responseJsonSchemaFile}
+	for _, file := range files {
+		report, declared := lintMockFile(file)
+		reports = append(reports, report)
+		schemas = append(schemas, declared...)
+	}
+	linted := make(map[string]bool)
+	for _, schema := range schemas {
+		if !linted[schema] {
+			linted[schema] = true
+			reports = append(reports, lintSchemaFile(schema))
+		}
+	}
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, report := range reports {
+			printValidationReport(report)
+		}
+	}
+
+	for _, report := range reports {
+		if !report.Valid {
+			return 1
+		}
+	}
+	return 0
+}
+
+// queries of a mapping file keyed otherwise than the requests carrying them, so they are never answered; schemas its header declares as well
+func lintMockFile(mockRequestResponseFile string) (ValidationReport, []string) {
+
+	report := ValidationReport{File: mockRequestResponseFile, Issues: []ValidationIssue{}}
+	var schemas []string
+
+	mock, positions, err := readMockFile(mockRequestResponseFile)
+	if err != nil {
+		report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: err.Error()})
+		return report, schemas
+	}
+	offsets, entries, err := splitMockEntries(mock)
+	report.Entries = len(entries)
+	if err != nil {
+		report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: "Unable to lint it: " + err.Error() + ". See " + programName() + " validate"})
+		return report, schemas
+	}
+	if len(entries) > 0 && entries[0].Schemas != nil {
+		if len(entries[0].Schemas.Req) > 0 {
+			schemas = append(schemas, relativeToFile(mockRequestResponseFile, entries[0].Schemas.Req))
+		}
+		if len(entries[0].Schemas.Res) > 0 {
+			schemas = append(schemas, relativeToFile(mockRequestResponseFile, entries[0].Schemas.Res))
+		}
+	}
+
+	debugRegexp := regexp.MustCompile("^" + DebugParameter + "")
+	for i, entry := range entries {
+		if entry.Schemas != nil || len(entry.Qry) == 0 {
+			continue
+		}
+		line, column := entryPosition(mock, positions, i, offsets[i])
+		issue := ValidationIssue{Entry: i, Line: line, Column: column, Pointer: "/" + strconv.Itoa(i) + "/query"}
+
+		// the loader keys the query as it is written, requests are keyed once parsed
+		keyed := orderQueryByParams(entry.Qry, debugRegexp)
+		values, err := url.ParseQuery(entry.Qry)
+		if err != nil {
+			issue.Error = "never matched, requests can't carry that query: " + err.Error()
+		} else if requested := QueryValuesAsString(values); requested != keyed {
+			issue.Error = "never matched, keyed as " + keyed + " while requests with that query are keyed as " + requested
+		} else {
+			continue
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	report.Valid = len(report.Issues) == 0
+	return report, schemas
+}
+
+// keywords of newer drafts a schema relies on, which are not enforced
+func lintSchemaFile(file string) ValidationReport {
+
+	report := ValidationReport{File: file, Issues: []ValidationIssue{}}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: err.Error()})
+		return report
+	}
+	// first value only, like the validator
+	var document interface{}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&document); err != nil {
+		report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: "Unable to lint it: " + err.Error()})
+		return report
+	}
+	if newer, unsupported := newerDraftKeywords(document); len(unsupported) > 0 {
+		report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: "draft " + newer + " validated as draft-07, not enforced: " + strings.Join(unsupported, ", ")})
+	}
+	report.Valid = len(report.Issues) == 0
+	return report
+}
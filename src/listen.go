@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Listen address: unix:<path> for a unix domain socket, otherwise [tcp:]<host>:<port>; empty means -host and -port
+var Listen = ""
+
+// ListenMode permissions of the unix domain socket, octal
+var ListenMode = "0660"
+
+// listener for FastCGI and plain HTTP alike, failing loudly
+func listen(address string) (net.Listener, error) {
+
+	if !strings.HasPrefix(address, "unix:") {
+		address = strings.TrimPrefix(address, "tcp:")
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, errors.New("Unable to listen at " + address + ": " + err.Error())
+		}
+		return listener, nil
+	}
+
+	path := strings.TrimPrefix(address, "unix:")
+	mode, err := strconv.ParseUint(ListenMode, 8, 32)
+	if err != nil {
+		return nil, errors.New("Unable to take -listen-mode=" + ListenMode + " as octal permissions")
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.New("Unable to listen at " + path + ": " + err.Error())
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, errors.New("Unable to set permissions of " + path + ": " + err.Error())
+	}
+
+	removeOnExit(path)
+	return listener, nil
+}
+
+// sockets to remove on exit, however many services listen at them
+var exitSockets []string
+var exitSocketsMutex sync.Mutex
+var exitSignals sync.Once
+
+// the socket goes away with the process, so the next run finds no stale one
+func removeOnExit(path string) {
+	exitSocketsMutex.Lock()
+	exitSockets = append(exitSockets, path)
+	exitSocketsMutex.Unlock()
+
+	exitSignals.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			log.Println("Stopped by " + sig.String())
+			exitSocketsMutex.Lock()
+			for _, socket := range exitSockets {
+				os.Remove(socket)
+			}
+			os.Exit(0)
+		}()
+	})
+}
+
+// socket left behind by a previous run that didn't exit cleanly; files other than sockets are never removed
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.New("Unable to listen at " + path + ": it exists and is not a socket")
+	}
+	// somebody still answering there
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return errors.New("Unable to listen at " + path + ": already in use")
+	}
+	log.Println("Removing stale socket " + path)
+	return os.Remove(path)
+}
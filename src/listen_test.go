@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unix socket paths are limited to about a hundred bytes, so kept short
+func testSocketDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// socket left at path as if its process had been killed
+func staleSocket(t *testing.T, path string) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+
+	dir := testSocketDir(t)
+
+	if err := removeStaleSocket(filepath.Join(dir, "none.sock")); err != nil {
+		t.Errorf("no socket: %v", err)
+	}
+
+	file := filepath.Join(dir, "file.sock")
+	if err := os.WriteFile(file, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(file); err == nil || !strings.Contains(err.Error(), "is not a socket") {
+		t.Errorf("regular file: %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("regular file removed: %v", err)
+	}
+
+	stale := filepath.Join(dir, "stale.sock")
+	staleSocket(t, stale)
+	if err := removeStaleSocket(stale); err != nil {
+		t.Errorf("stale socket: %v", err)
+	}
+	if _, err := os.Lstat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale socket kept: %v", err)
+	}
+
+	live := filepath.Join(dir, "live.sock")
+	listener, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if err := removeStaleSocket(live); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("live socket: %v", err)
+	}
+	if _, err := os.Lstat(live); err != nil {
+		t.Errorf("live socket removed: %v", err)
+	}
+}
+
+func TestListenOverStaleSocket(t *testing.T) {
+
+	path := filepath.Join(testSocketDir(t), "jsonmock.sock")
+	staleSocket(t, path)
+
+	listener, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0660 {
+		t.Errorf("socket mode %v", info.Mode())
+	}
+
+	// a second run finds it in use
+	if _, err := listen("unix:" + path); err == nil {
+		t.Error("listening twice at the same socket")
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// what a load test is told to do, by JsonMock loadtest or by its go test wrapper
+type loadtestOptions struct {
+	queryStr  string
+	maps      mapFlag
+	checkUp   bool
+	gzipOn    bool
+	workers   int
+	requests  uint64
+	duration  time.Duration
+	keepAlive bool
+	maxConns  int
+	caFile    string
+	certFile  string
+	keyFile   string
+	http2On   bool
+	maxErrors uint64
+}
+
+// LoadtestReport summary of a load test
+type LoadtestReport struct {
+	Requests uint64            `json:"requests"`
+	Success  uint64            `json:"success"`
+	Failed   uint64            `json:"failed"`
+	Seconds  float64           `json:"seconds"`
+	Rate     float64           `json:"rate"` // requests per second
+	Latency  LoadtestLatency   `json:"latencyMs"`
+	Statuses map[string]uint64 `json:"statuses"` // by status code, "error" when there was no answer at all
+}
+
+// LoadtestLatency percentiles in milliseconds
+type LoadtestLatency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// a fixture to send, its expected answer
+type loadtestFixture struct {
+	query    string
+	request  string
+	response string
+}
+
+// what a single worker saw, merged once every worker is done
+type loadtestStats struct {
+	success   uint64
+	failed    uint64
+	latencies latencyHistogram
+	statuses  map[string]uint64
+}
+
+// flags of a load test on any flag set: the command's own or the test binary's one
+func loadtestFlags(flags *flag.FlagSet) *loadtestOptions {
+
+	options := &loadtestOptions{
+		queryStr:  "http://0.0.0.0/testingEnd?",
+		maps:      mapFlag{files: []string{dataFilePath(MockRequestResponseFile)}},
+		checkUp:   true,
+		gzipOn:    true,
+		workers:   3 * runtime.NumCPU(),
+		maxErrors: 10,
+	}
+	flags.StringVar(&options.queryStr, "queryStr", options.queryStr, "Testing End address, including 'debug' parameter if needed")
+	flags.Var(&options.maps, "map", "Fake mapped request/response file, directory or glob to send. Can be repeated.")
+	flags.BoolVar(&options.checkUp, "checkUp", options.checkUp, "Check it out that FastCGI is up and running through a HEAD request.")
+	flags.BoolVar(&options.gzipOn, "gzipOn", options.gzipOn, "Activate GZIP by adding specific header to the request. That might make all tests fail")
+	flags.IntVar(&options.workers, "workers", options.workers, "Requests in flight at once, each worker sending the next one as soon as its answer is checked.")
+	flags.IntVar(&options.workers, "goroutinesMax", options.workers, "Same as -workers.")
+	flags.Uint64Var(&options.requests, "requests", options.requests, "Requests to send, going round the fixtures. 0 for each fixture once, or as many as -duration allows.")
+	flags.DurationVar(&options.duration, "duration", options.duration, "Keep sending requests, going round the fixtures, for that long, like 30s.")
+	flags.BoolVar(&options.keepAlive, "keepAlive", options.keepAlive, "Reuse HTTP/1.1 connections between requests, instead of a new one for each request.")
+	flags.IntVar(&options.maxConns, "maxConns", options.maxConns, "Most HTTP/1.1 connections open at once. 0 for one per worker at most.")
+	flags.StringVar(&options.caFile, "caFile", options.caFile, "CA to trust for https -queryStr, like the one written by JsonMock -tls-auto.")
+	flags.StringVar(&options.certFile, "certFile", options.certFile, "Client certificate for servers asking for them (mutual TLS).")
+	flags.StringVar(&options.keyFile, "keyFile", options.keyFile, "Key of -certFile.")
+	flags.BoolVar(&options.http2On, "http2", options.http2On, "Send every request over HTTP/2, multiplexed: h2 for https -queryStr, prior knowledge h2c for http.")
+	flags.Uint64Var(&options.maxErrors, "maxErrors", options.maxErrors, "Failed requests told about, the rest are just counted. 0 for all of them.")
+	return options
+}
+
+// wrong settings, before anything is sent
+func (options *loadtestOptions) check() error {
+	queryStr := options.queryStr
+	if len(queryStr) < 2 || strings.Index(queryStr, "?") != (len(queryStr)-1) || strings.LastIndex(queryStr, "/") == (len(queryStr)-2) {
+		return fmt.Errorf("Check it out that your -queryStr %v is the correct one expected by NGINX and ends in '?'", queryStr)
+	}
+	if _, err := url.ParseRequestURI(queryStr); err != nil {
+		return fmt.Errorf("Check it out that your -queryStr %v is a correct URL", queryStr)
+	}
+	if options.workers < 1 {
+		return errors.New("Check it out that your -workers is at least 1")
+	}
+	return nil
+}
+
+// every fixture sent to a running server, its answer checked: JsonMock loadtest -queryStr=... -map=... -duration=... -requests=...
+func loadtestCommand(args []string) int {
+
+	format := "human"
+	flags := commandFlags("loadtest")
+	options := loadtestFlags(flags)
+	flags.StringVar(&format, "format", format, "Report format: human or json.")
+	flags.Parse(args)
+
+	if format != "human" && format != "json" {
+		fmt.Fprintln(os.Stderr, "Unknown -format "+format+". Use human or json.")
+		return 2
+	}
+	if err := options.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	report, err := runLoadtest(options, func(failure string) { fmt.Fprintln(os.Stderr, failure) })
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if format == "json" {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printLoadtestReport(os.Stdout, report)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// fixed pool of workers sending the fixtures round and round until the targets are met; failures are told about to failure, from any worker
+func runLoadtest(options *loadtestOptions, failure func(string)) (*LoadtestReport, error) {
+
+	client, err := loadtestClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("Check it out your -caFile, -certFile and -keyFile: %v", err)
+	}
+
+	// grab the real queries to launch
+	files, err := expandMapFiles(options.maps.files)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []loadtestFixture
+	for _, file := range files {
+		err := forEachMockEntry(file, nil, func(query string, request string, response string) {
+			fixtures = append(fixtures, loadtestFixture{query: query, request: request, response: response})
+		})
+		if err != nil {
+			return nil, errors.New(file + ": " + err.Error())
+		}
+	}
+	if len(fixtures) == 0 {
+		return nil, errors.New("Unable to find any fixture to send at -map")
+	}
+
+	// call that fastcgi to checkout whether it's up or not
+	if options.checkUp {
+		ping, err := client.Head(options.queryStr)
+		if err != nil {
+			return nil, errors.New("Unable to request for HEAD info to the server. " + err.Error())
+		}
+		ping.Body.Close()
+		if ping.StatusCode != http.StatusOK {
+			return nil, errors.New("Probably FastCGI down: " + ping.Status)
+		}
+	}
+
+	// fixtures to send, by index, until the targets are met
+	jobs := make(chan uint64, options.workers)
+	var deadline <-chan time.Time
+	if options.duration > 0 {
+		timer := time.NewTimer(options.duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	go func() {
+		defer close(jobs)
+		for sent := uint64(0); ; sent++ {
+			if options.requests > 0 && sent >= options.requests {
+				return
+			}
+			if options.requests == 0 && options.duration == 0 && sent >= uint64(len(fixtures)) {
+				return
+			}
+			select {
+			case <-deadline:
+				return
+			case jobs <- sent:
+			}
+		}
+	}()
+
+	var reported uint64
+	stats := make([]loadtestStats, options.workers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := range stats {
+		wg.Add(1)
+		go func(stats *loadtestStats) {
+			defer wg.Done()
+			stats.statuses = make(map[string]uint64)
+			for current := range jobs {
+				fixture := fixtures[current%uint64(len(fixtures))]
+				query := options.queryStr + fixture.query
+				sent := time.Now()
+				status, err := loadtestRequest(client, query, fixture.request, fixture.response, options.gzipOn, options.http2On)
+				stats.latencies.add(time.Since(sent))
+				stats.statuses[status]++
+				if err == nil {
+					stats.success++
+					continue
+				}
+				stats.failed++
+				if n := atomic.AddUint64(&reported, 1); options.maxErrors == 0 || n <= options.maxErrors {
+					failure(fmt.Sprintf("<%d> [%s]%s: %v", current, query, fixture.request, err))
+				}
+			}
+		}(&stats[w])
+	}
+	wg.Wait()
+	return newLoadtestReport(stats, time.Since(start)), nil
+}
+
+func newLoadtestReport(stats []loadtestStats, elapsed time.Duration) *LoadtestReport {
+
+	report := &LoadtestReport{Seconds: elapsed.Seconds(), Statuses: make(map[string]uint64)}
+	var latencies latencyHistogram
+	for i := range stats {
+		report.Success += stats[i].success
+		report.Failed += stats[i].failed
+		latencies.merge(&stats[i].latencies)
+		for status, count := range stats[i].statuses {
+			report.Statuses[status] += count
+		}
+	}
+	report.Requests = report.Success + report.Failed
+	if elapsed > 0 {
+		report.Rate = float64(report.Requests) / elapsed.Seconds()
+	}
+	if latencies.count == 0 {
+		return report
+	}
+	report.Latency = LoadtestLatency{
+		Min:  milliseconds(latencies.min),
+		Mean: milliseconds(latencies.total / time.Duration(latencies.count)),
+		P50:  milliseconds(latencies.percentile(0.50)),
+		P90:  milliseconds(latencies.percentile(0.90)),
+		P99:  milliseconds(latencies.percentile(0.99)),
+		Max:  milliseconds(latencies.max),
+	}
+	return report
+}
+
+// buckets of the latency histogram, from 1µs on, each one 1% wider than the previous one: up to about 11 minutes
+const latencyBuckets = 2048
+
+var latencyGrowth = math.Log(1.01)
+
+// latencies counted by bucket, so memory doesn't grow with the requests sent; min, max and mean are exact
+type latencyHistogram struct {
+	counts [latencyBuckets]uint64
+	count  uint64
+	total  time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func latencyBucket(latency time.Duration) int {
+	if latency <= time.Microsecond {
+		return 0
+	}
+	bucket := int(math.Log(float64(latency)/float64(time.Microsecond)) / latencyGrowth)
+	if bucket >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return bucket
+}
+
+func (h *latencyHistogram) add(latency time.Duration) {
+	h.counts[latencyBucket(latency)]++
+	if h.count == 0 || latency < h.min {
+		h.min = latency
+	}
+	if latency > h.max {
+		h.max = latency
+	}
+	h.count++
+	h.total += latency
+}
+
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	if other.count == 0 {
+		return
+	}
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.count += other.count
+	h.total += other.total
+}
+
+// nearest rank, as the upper bound of its bucket: 1% off at most
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	rank := uint64(math.Ceil(p * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for bucket, count := range h.counts {
+		seen += count
+		if seen < rank {
+			continue
+		}
+		upper := time.Duration(float64(time.Microsecond) * math.Exp(float64(bucket+1)*latencyGrowth))
+		if upper > h.max {
+			return h.max
+		}
+		if upper < h.min {
+			return h.min
+		}
+		return upper
+	}
+	return h.max
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
+
+func printLoadtestReport(out io.Writer, report *LoadtestReport) {
+	fmt.Fprintf(out, "Total requests sent: %d: success %d, failed %d\n", report.Requests, report.Success, report.Failed)
+	fmt.Fprintf(out, "Elapsed %.3fs, %.1f requests/s\n", report.Seconds, report.Rate)
+	latency := report.Latency
+	fmt.Fprintf(out, "Latency ms: min %.3f, mean %.3f, p50 %.3f, p90 %.3f, p99 %.3f, max %.3f\n", latency.Min, latency.Mean, latency.P50, latency.P90, latency.P99, latency.Max)
+	var statuses []string
+	for status := range report.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for i, status := range statuses {
+		statuses[i] = status + ": " + strconv.FormatUint(report.Statuses[status], 10)
+	}
+	fmt.Fprintln(out, "Statuses: "+strings.Join(statuses, ", "))
+}
+
+// a single fixture: its answer must be the expected one, whatever its case; its status code or "error" when not answered
+func loadtestRequest(client *http.Client, query string, req string, expected string, gzipOn bool, http2On bool) (string, error) {
+
+	request, err := http.NewRequest("POST", query, strings.NewReader(req))
+	if err != nil {
+		return "error", err
+	}
+
+	// headeres
+	if gzipOn {
+		request.Header.Add("Accept-Encoding", "gzip")
+	}
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Content-Length", strconv.Itoa(len(req)))
+
+	// making the call
+	response, err := client.Do(request)
+	if err != nil {
+		return "error", err
+	}
+	// whatever is left is read, so the connection can be reused
+	defer func() {
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+	}()
+	status := strconv.Itoa(response.StatusCode)
+	if http2On && response.ProtoMajor != 2 {
+		return status, errors.New("answered over " + response.Proto)
+	}
+	if response.StatusCode != http.StatusOK {
+		return status, errors.New("answered " + response.Status)
+	}
+
+	// double check the response depending on GZIP usage
+	var reader io.Reader = response.Body
+	if response.Header.Get("Content-Encoding") == "gzip" {
+		unzipped, err := gzip.NewReader(response.Body)
+		if err != nil {
+			return status, err
+		}
+		defer unzipped.Close()
+		reader = unzipped
+	}
+	res, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return status, err
+	}
+	if !strings.EqualFold(string(res), expected) {
+		return status, errors.New("received->" + string(res) + " expected->" + expected)
+	}
+	return status, nil
+}
+
+// HTTP/2 multiplexes every request over a single connection; HTTP/1.1 opens one per request, unless -keepAlive
+func loadtestClient(options *loadtestOptions) (*http.Client, error) {
+	config, err := loadtestTLSConfig(options.caFile, options.certFile, options.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if options.http2On {
+		return &http.Client{Transport: loadtestHTTP2Transport(options.queryStr, config)}, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	transport.DisableKeepAlives = !options.keepAlive
+	transport.MaxIdleConnsPerHost = options.workers
+	transport.MaxConnsPerHost = options.maxConns
+	return &http.Client{Transport: transport}, nil
+}
+
+// trusted CA and client certificate, if any
+func loadtestTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	if len(caFile) == 0 && len(certFile) == 0 {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if len(caFile) > 0 {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("no PEM certificate at " + caFile)
+		}
+	}
+	if len(certFile) > 0 {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// HTTP/2 only, every request multiplexed over the same connection
+func loadtestHTTP2Transport(queryStr string, config *tls.Config) *http2.Transport {
+	transport := &http2.Transport{TLSClientConfig: config}
+	if strings.HasPrefix(queryStr, "http:") {
+		// h2c with prior knowledge: HTTP/2 straight away, no TLS
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network string, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return transport
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+
+	// 1ms to 10s, every millisecond once
+	var h latencyHistogram
+	for ms := 1; ms <= 10000; ms++ {
+		h.add(time.Duration(ms) * time.Millisecond)
+	}
+	// merged out of two halves, the same
+	var first, second, merged latencyHistogram
+	for ms := 1; ms <= 10000; ms++ {
+		if ms%2 == 0 {
+			first.add(time.Duration(ms) * time.Millisecond)
+		} else {
+			second.add(time.Duration(ms) * time.Millisecond)
+		}
+	}
+	merged.merge(&first)
+	merged.merge(&second)
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.50, 5000 * time.Millisecond},
+		{0.90, 9000 * time.Millisecond},
+		{0.99, 9900 * time.Millisecond},
+		{1, 10000 * time.Millisecond},
+		{0, time.Millisecond},
+	}
+	for _, histogram := range []*latencyHistogram{&h, &merged} {
+		if histogram.count != 10000 || histogram.min != time.Millisecond || histogram.max != 10*time.Second {
+			t.Fatalf("count %d, min %v, max %v", histogram.count, histogram.min, histogram.max)
+		}
+		for _, test := range tests {
+			got := histogram.percentile(test.p)
+			if math.Abs(float64(got-test.want)) > 0.01*float64(test.want) {
+				t.Errorf("p%v = %v, want %v within 1%%", test.p*100, got, test.want)
+			}
+		}
+	}
+}
+
+func TestLatencyBucketBounds(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		bucket  int
+	}{
+		{0, 0},
+		{time.Microsecond, 0},
+		{time.Hour, latencyBuckets - 1},
+	}
+	for _, test := range tests {
+		if got := latencyBucket(test.latency); got != test.bucket {
+			t.Errorf("latencyBucket(%v) = %d, want %d", test.latency, got, test.bucket)
+		}
+	}
+}
+
+func TestRunLoadtest(t *testing.T) {
+
+	file := writeTestFile(t, "map.json", `[
+{"req":{"id":"1"},"res":{"ok":true}},
+{"query":"q=2","req":{"id":"2"},"res":{"ok":false}}
+]`)
+	// the first fixture is answered as expected, the second one is not
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.Method == "HEAD":
+		case string(body) == `{"id":"1"}`:
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		requests uint64
+		success  uint64
+		failed   uint64
+	}{
+		{"each fixture once", 0, 1, 1},
+		{"round the fixtures", 7, 4, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := &loadtestOptions{queryStr: server.URL + "/x?", maps: mapFlag{files: []string{file}}, checkUp: true, workers: 3, requests: test.requests, keepAlive: true}
+			if err := options.check(); err != nil {
+				t.Fatal(err)
+			}
+			var failures uint64
+			report, err := runLoadtest(options, func(string) { atomic.AddUint64(&failures, 1) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Success != test.success || report.Failed != test.failed || report.Requests != test.success+test.failed {
+				t.Errorf("report %+v, want success %d, failed %d", report, test.success, test.failed)
+			}
+			if failures != test.failed {
+				t.Errorf("%d failures told about, want %d", failures, test.failed)
+			}
+			if report.Statuses["200"] != test.success || report.Statuses["404"] != test.failed {
+				t.Errorf("statuses %v", report.Statuses)
+			}
+			if report.Latency.Max < report.Latency.Min || report.Latency.P50 > report.Latency.Max {
+				t.Errorf("latency %+v", report.Latency)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// optional first entry of a mapping file: { "schemas": { "req": "...", "res": "..." } }
+type MockSchemas struct {
+	Req string `json:"req,omitempty"`
+	Res string `json:"res,omitempty"`
+}
+
+// -map can be repeated and every value can be a file, a directory or a glob
+type mapFlag struct {
+	files []string
+	set   bool
+}
+
+func (m *mapFlag) String() string {
+	return strings.Join(m.files, ",")
+}
+
+func (m *mapFlag) values() []string {
+	return m.files
+}
+
+func (m *mapFlag) Set(value string) error {
+	// first explicit value replaces the default one
+	if !m.set {
+		m.files = nil
+		m.set = true
+	}
+	m.files = append(m.files, value)
+	return nil
+}
+
+// every mapping file behind the -map values, directories expanded to their files in any supported format
+func expandMapFiles(patterns []string) ([]string, error) {
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		var matches []string
+		info, err := os.Stat(pattern)
+		if err == nil && info.IsDir() {
+			for _, extension := range MockFileExtensions {
+				found, _ := filepath.Glob(filepath.Join(pattern, "*"+extension))
+				matches = append(matches, found...)
+			}
+		} else if err != nil && strings.ContainsAny(pattern, "*?[") {
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return files, errors.New("Wrong -map pattern " + pattern + ": " + err.Error())
+			}
+		} else if err == nil {
+			matches = []string{pattern}
+		}
+		if len(matches) == 0 {
+			return files, errors.New("No Mock Request Response File found at " + pattern)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if !seen[filepath.Clean(match)] {
+				seen[filepath.Clean(match)] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// a mapping file that can't be read or validated: startup fails even when fixtures might come from elsewhere
+type mockFileError struct {
+	file string
+	err  error
+}
+
+func (e *mockFileError) Error() string {
+	return fmt.Sprintf("Unable to load %s: %v", e.file, e.err)
+}
+
+// load and merge every mapping file, the first broken one stops it; duplicated keys are reported per file
+func loadMockRequestResponseFiles(patterns []string, requestJsonSchemaFile string, responseJsonSchemaFile string, debug bool) (*RequestResponseMap, *gojsonschema.Schema, error) {
+
+	reqresmap := newRequestResponseMap(0)
+
+	// incoming requests are checked against the global request schema
+	reqJsonSchema, err := loadSchemaFile(requestJsonSchemaFile)
+	if err != nil {
+		log.Println(err)
+		return reqresmap, reqJsonSchema, errors.New("Unable to read Request Json Schema File.")
+	}
+
+	files, err := expandMapFiles(patterns)
+	if err != nil {
+		return reqresmap, reqJsonSchema, err
+	}
+
+	var set mockFileSet
+	for _, file := range files {
+		filemap, fileRequestSchema, err := validateMockRequestResponseFile(file, requestJsonSchemaFile, responseJsonSchemaFile, debug)
+		if err == nil {
+			err = set.loaded(fileRequestSchema, filemap.Len())
+		}
+		if err != nil {
+			return reqresmap, reqJsonSchema, &mockFileError{file: file, err: err}
+		}
+		// the first file is taken as it is, the next ones are merged without copying their fixtures
+		loaded := filemap.Len()
+		if reqresmap.Len() == 0 {
+			reqresmap = filemap
+		} else {
+			loaded = reqresmap.merge(filemap, func(key string) {
+				log.Println(file + ": duplicated key " + key + " already defined at a previous file. It will be ignored")
+			})
+		}
+		if len(files) > 1 {
+			log.Printf("%s: %d fake request/response", file, loaded)
+		}
+	}
+
+	// unknown requests are checked against the request schemas of the loaded files
+	if len(set.requestSchemas) > 1 {
+		log.Println("Requests not matching any fixture are checked against any of " + strings.Join(set.requestSchemas, ", "))
+	}
+	if reqJsonSchema, err = set.requestSchema(requestJsonSchemaFile); err != nil {
+		log.Println(err)
+		return reqresmap, reqJsonSchema, errors.New("Unable to read Request Json Schema File.")
+	}
+
+	if reqresmap.Len() == 0 {
+		err = errors.New("Unable to validate any entry at Mock Request Response Files")
+	}
+	return reqresmap, reqJsonSchema, err
+}
+
+// checks the loader runs across the mapping files, shared by index and validate so none of them disagrees
+type mockFileSet struct {
+	requestSchemas []string // applied by the files, each file might declare its own
+}
+
+// a mapping file once walked: it must bring some valid fixture
+func (s *mockFileSet) loaded(requestSchema string, fixtures int) error {
+	if fixtures == 0 {
+		return errors.New("Unable to validate any entry at Mock Request Response File")
+	}
+	for _, known := range s.requestSchemas {
+		if filepath.Clean(known) == filepath.Clean(requestSchema) {
+			return nil
+		}
+	}
+	s.requestSchemas = append(s.requestSchemas, requestSchema)
+	return nil
+}
+
+// schema unknown requests are checked against: the one every file applies, any of them when they differ, or the given one when no file was loaded
+func (s *mockFileSet) requestSchema(requestJsonSchemaFile string) (*gojsonschema.Schema, error) {
+	switch len(s.requestSchemas) {
+	case 0:
+		return loadSchemaFile(requestJsonSchemaFile)
+	case 1:
+		return loadSchemaFile(s.requestSchemas[0])
+	}
+	var anyOf []interface{}
+	for _, file := range s.requestSchemas {
+		url, err := fileURL(file)
+		if err != nil {
+			return nil, err
+		}
+		anyOf = append(anyOf, map[string]interface{}{"$ref": url})
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewGoLoader(map[string]interface{}{"anyOf": anyOf}))
+}
+
+// paths at a mapping file are relative to that file
+func relativeToFile(file string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(file), filepath.FromSlash(path))
+}
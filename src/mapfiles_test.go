@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMockRequestResponseFiles(t *testing.T) {
+
+	files := map[string]string{
+		"a.json":       `[{"req":{"id":"1"},"res":{"id":"1"}},{"req":{"id":"2"},"res":{"id":"2"}}]`,
+		"b.json":       `[{"req":{"id":"2"},"res":{"id":"3"}},{"req":{"id":"3"},"res":{"id":"3"}}]`,
+		"broken.json":  `[{"req":{"id":"1"},"res":{"id":"1"}},{"req":`,
+		"invalid.json": `[{"req":{"id":"1"}}]`,
+		"none.json":    `[{"req":{"id":1},"res":{"id":"1"}}]`,
+		"c.json":       `[{"schemas":{"req":"named.json"}},{"req":{"name":"c"},"res":{"id":"1"}}]`,
+		"d.json":       `[{"schemas":{"req":"./named.json"}},{"req":{"name":"d"},"res":{"id":"1"}}]`,
+		"named.json":   `{"type":"object","required":["name"]}`,
+	}
+
+	tests := []struct {
+		name   string
+		maps   []string
+		loaded int
+		broken bool // a mapping file stops the startup
+		err    bool
+		named  bool // unknown requests checked against named.json
+		id     bool // unknown requests checked against -req
+	}{
+		{"merged", []string{"a.json", "b.json"}, 3, false, false, false, true},
+		{"broken json", []string{"a.json", "broken.json"}, 0, true, true, false, false},
+		{"invalid entry", []string{"invalid.json", "a.json"}, 0, true, true, false, false},
+		{"no valid entry", []string{"a.json", "none.json"}, 0, true, true, false, false},
+		{"missing", []string{"missing.json"}, 0, false, true, false, false},
+		{"different request schemas", []string{"a.json", "c.json"}, 3, false, false, true, true},
+		{"shared request schema", []string{"c.json", "d.json"}, 2, false, false, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, req, res := writeTestSchemas(t)
+			for name, content := range files {
+				os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+			}
+			var maps []string
+			for _, name := range test.maps {
+				maps = append(maps, filepath.Join(dir, name))
+			}
+
+			fixtures, reqSchema, err := loadMockRequestResponseFiles(maps, req, res, false)
+			if (err != nil) != test.err {
+				t.Fatalf("error %v", err)
+			}
+			if _, broken := err.(*mockFileError); broken != test.broken {
+				t.Errorf("error %v, broken file %t", err, test.broken)
+			}
+			if err == nil && fixtures.Len() != test.loaded {
+				t.Errorf("%d fixtures loaded, want %d", fixtures.Len(), test.loaded)
+			}
+			if err == nil && (validateRequest(reqSchema, `{"name":"x"}`) != test.named || validateRequest(reqSchema, `{"id":"x"}`) != test.id) {
+				t.Errorf("unknown requests not checked against the request schemas of the loaded files")
+			}
+		})
+	}
+}
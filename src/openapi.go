@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenApiFile OpenAPI 3 document to take schemas and fixtures from, empty means none
+var OpenApiFile = ""
+
+// http methods an OpenAPI path item may define
+var openApiMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// keywords without meaning for Json Schema validation, or meaning something else there
+var openApiOnlyKeywords = []string{"nullable", "discriminator", "readOnly", "writeOnly", "xml", "externalDocs", "example", "examples", "deprecated"}
+
+// one operation of the document, routed by path and method
+type openApiRoute struct {
+	method    string
+	path      string
+	reqSchema *gojsonschema.Schema
+	fixtures  *RequestResponseMap
+}
+
+// only the parts needed to route and validate
+type openApiDocument struct {
+	OpenApi string `json:"openapi"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+	root        json.RawMessage
+	definitions map[string]interface{}
+}
+
+type openApiOperation struct {
+	OperationId string                     `json:"operationId"`
+	Parameters  []json.RawMessage          `json:"parameters"`
+	RequestBody json.RawMessage            `json:"requestBody"`
+	Responses   map[string]json.RawMessage `json:"responses"`
+}
+
+type openApiParameter struct {
+	Name    string          `json:"name"`
+	In      string          `json:"in"`
+	Example json.RawMessage `json:"example"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+// request bodies and responses
+type openApiContent struct {
+	Content map[string]openApiMediaType `json:"content"`
+}
+
+type openApiMediaType struct {
+	Schema   json.RawMessage            `json:"schema"`
+	Example  json.RawMessage            `json:"example"`
+	Examples map[string]json.RawMessage `json:"examples"`
+}
+
+// named example; empty name for the single example ones
+type openApiExample struct {
+	name  string
+	value json.RawMessage
+}
+
+// every operation of an OpenAPI 3 document, json or yaml, with its schemas and the fixtures of its examples
+func loadOpenApiRoutes(file string, debug bool) ([]openApiRoute, error) {
+
+	var routes []openApiRoute
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Println(err)
+		return routes, errors.New("Unable to read OpenAPI File.")
+	}
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJson(data); err != nil {
+			log.Println(err)
+			return routes, errors.New("Unable to process OpenAPI File.")
+		}
+	}
+
+	var doc openApiDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Println(err)
+		return routes, errors.New("Unable to process OpenAPI File.")
+	}
+	if !strings.HasPrefix(doc.OpenApi, "3.") {
+		return routes, errors.New("Unable to process OpenAPI File: only OpenAPI 3 documents are supported")
+	}
+	doc.root = data
+
+	// every component schema is available to every operation schema
+	doc.definitions = make(map[string]interface{})
+	for name, raw := range doc.Components.Schemas {
+		schema, err := doc.jsonSchema(raw)
+		if err != nil {
+			log.Println("OpenAPI: schema " + name + " will be ignored: " + err.Error())
+			continue
+		}
+		doc.definitions[name] = schema
+	}
+
+	basePath := ""
+	if len(doc.Servers) > 0 {
+		if u, err := url.Parse(doc.Servers[0].URL); err == nil && !strings.Contains(u.Path, "{") {
+			basePath = strings.TrimSuffix(u.Path, "/")
+		}
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := doc.Paths[path]
+		var common []json.RawMessage
+		if raw, ok := item["parameters"]; ok {
+			json.Unmarshal(raw, &common)
+		}
+		for _, method := range openApiMethods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var operation openApiOperation
+			if err := json.Unmarshal(raw, &operation); err != nil {
+				log.Println("OpenAPI: " + strings.ToUpper(method) + " " + path + " will be ignored: " + err.Error())
+				continue
+			}
+			operation.Parameters = append(append([]json.RawMessage{}, common...), operation.Parameters...)
+			route, err := doc.route(strings.ToUpper(method), basePath+path, operation, debug)
+			if err != nil {
+				log.Println("OpenAPI: " + strings.ToUpper(method) + " " + path + " will be ignored: " + err.Error())
+				continue
+			}
+			routes = append(routes, route)
+		}
+	}
+
+	if len(routes) == 0 {
+		err = errors.New("Unable to find any operation at OpenAPI File")
+	}
+	return routes, err
+}
+
+// schemas and fixtures of a single operation
+func (doc *openApiDocument) route(method string, path string, operation openApiOperation, debug bool) (openApiRoute, error) {
+
+	route := openApiRoute{method: method, path: path, fixtures: newRequestResponseMap(0)}
+	name := method + " " + path
+
+	// operations without json body accept whatever
+	var reqJS gojsonschema.JSONLoader = gojsonschema.NewStringLoader("{}")
+	var requests []openApiExample
+	var err error
+	if media, ok := doc.jsonMediaType(operation.RequestBody); ok && media.Schema != nil {
+		if reqJS, err = doc.schemaLoader(media.Schema); err != nil {
+			return route, err
+		}
+		requests = doc.examples(media)
+	}
+	if route.reqSchema, err = gojsonschema.NewSchema(reqJS); err != nil {
+		return route, err
+	}
+
+	// mock answers are always successful ones
+	var resJS gojsonschema.JSONLoader = gojsonschema.NewStringLoader("{}")
+	var responses []openApiExample
+	if media, ok := doc.jsonMediaType(doc.successResponse(operation.Responses)); ok {
+		if media.Schema != nil {
+			if resJS, err = doc.schemaLoader(media.Schema); err != nil {
+				return route, err
+			}
+		}
+		responses = doc.examples(media)
+	}
+	resSchema, err := gojsonschema.NewSchema(resJS)
+	if err != nil {
+		return route, err
+	}
+
+	query := doc.exampleQuery(operation.Parameters)
+	if operation.RequestBody == nil {
+		// no body at all, just the query
+		requests = []openApiExample{{name: "", value: nil}}
+	}
+
+	// same names go together; otherwise the unnamed, or first, response example
+	named := make(map[string]json.RawMessage)
+	for _, response := range responses {
+		named[response.name] = response.value
+	}
+	for _, request := range requests {
+		answer, ok := named[request.name]
+		if !ok {
+			answer, ok = named[""]
+		}
+		if !ok && len(responses) > 0 {
+			answer = responses[0].value
+		}
+		if answer == nil {
+			if debug {
+				log.Println("OpenAPI: " + name + " example " + request.name + " without response example, ignored")
+			}
+			continue
+		}
+
+		key := ""
+		if request.value != nil {
+			compacted, err := compactObject(request.value)
+			if err == nil {
+				err = schemaViolation(route.reqSchema, compacted)
+			}
+			if err != nil {
+				log.Println("OpenAPI: " + name + " request example " + request.name + " will be ignored: " + err.Error())
+				continue
+			}
+			key = compacted
+		}
+		response, err := compactObject(answer)
+		if err == nil {
+			err = schemaViolation(resSchema, response)
+		}
+		if err != nil {
+			log.Println("OpenAPI: " + name + " response example " + request.name + " will be ignored: " + err.Error())
+			continue
+		}
+		key = mapKey(query, key)
+		if !route.fixtures.Add(key, QueryResponse{query: query, response: response}) {
+			continue
+		}
+		if debug {
+			log.Printf("OpenAPI: %s %v -> %v\n", name, key, response)
+		}
+	}
+	return route, nil
+}
+
+// paths of the document answer 405 to the methods it doesn't define
+func methodNotAllowed(methods []string) http.Handler {
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		http.Error(w, "method not allowed, expected "+allow, http.StatusMethodNotAllowed)
+	})
+}
+
+// examples of a media type, named ones first by name
+func (doc *openApiDocument) examples(media openApiMediaType) []openApiExample {
+	var examples []openApiExample
+	names := make([]string, 0, len(media.Examples))
+	for name := range media.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var example struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(doc.resolve(media.Examples[name]), &example); err == nil && example.Value != nil {
+			examples = append(examples, openApiExample{name: name, value: example.Value})
+		}
+	}
+	if media.Example != nil {
+		examples = append(examples, openApiExample{name: "", value: media.Example})
+	} else if len(examples) == 0 && media.Schema != nil {
+		var schema struct {
+			Example json.RawMessage `json:"example"`
+		}
+		if err := json.Unmarshal(doc.resolve(media.Schema), &schema); err == nil && schema.Example != nil {
+			examples = append(examples, openApiExample{name: "", value: schema.Example})
+		}
+	}
+	return examples
+}
+
+// query params with examples, in the same order the mock uses
+func (doc *openApiDocument) exampleQuery(parameters []json.RawMessage) string {
+	values := url.Values{}
+	for _, raw := range parameters {
+		var parameter openApiParameter
+		if err := json.Unmarshal(doc.resolve(raw), &parameter); err != nil || parameter.In != "query" {
+			continue
+		}
+		example := parameter.Example
+		if example == nil && parameter.Schema != nil {
+			var schema struct {
+				Example json.RawMessage `json:"example"`
+			}
+			json.Unmarshal(doc.resolve(parameter.Schema), &schema)
+			example = schema.Example
+		}
+		if example == nil {
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(example, &text); err != nil {
+			text = string(bytes.TrimSpace(example))
+		}
+		values.Add(parameter.Name, text)
+	}
+	return orderQueryByParams(QueryValuesAsString(values), regexp.MustCompile("^"+DebugParameter+""))
+}
+
+// 200, otherwise the first 2xx or default
+func (doc *openApiDocument) successResponse(responses map[string]json.RawMessage) json.RawMessage {
+	if raw, ok := responses["200"]; ok {
+		return raw
+	}
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	if len(codes) > 0 {
+		return responses[codes[0]]
+	}
+	return responses["default"]
+}
+
+// application/json, or any +json, content of a request body or response
+func (doc *openApiDocument) jsonMediaType(raw json.RawMessage) (openApiMediaType, bool) {
+	var content openApiContent
+	if raw == nil || json.Unmarshal(doc.resolve(raw), &content) != nil {
+		return openApiMediaType{}, false
+	}
+	mimeTypes := make([]string, 0, len(content.Content))
+	for mimeType := range content.Content {
+		if isJsonMimeType(mimeType) {
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+	}
+	if len(mimeTypes) == 0 {
+		return openApiMediaType{}, false
+	}
+	sort.Strings(mimeTypes)
+	return content.Content[mimeTypes[0]], true
+}
+
+// follow local $ref until a real object is found; external ones are not supported
+func (doc *openApiDocument) resolve(raw json.RawMessage) json.RawMessage {
+	for hops := 0; hops < 32; hops++ {
+		var ref struct {
+			Ref string `json:"$ref"`
+		}
+		if json.Unmarshal(raw, &ref) != nil || len(ref.Ref) == 0 {
+			return raw
+		}
+		if !strings.HasPrefix(ref.Ref, "#/") {
+			log.Println("OpenAPI: only local references are supported, ignored " + ref.Ref)
+			return nil
+		}
+		raw = doc.root
+		for _, token := range strings.Split(ref.Ref[2:], "/") {
+			token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+			var object map[string]json.RawMessage
+			if json.Unmarshal(raw, &object) != nil {
+				return nil
+			}
+			if raw = object[token]; raw == nil {
+				log.Println("OpenAPI: unable to resolve " + ref.Ref)
+				return nil
+			}
+		}
+	}
+	return raw
+}
+
+// OpenAPI schema object as a draft-04 Json Schema
+func (doc *openApiDocument) jsonSchema(raw json.RawMessage) (interface{}, error) {
+	var schema interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, err
+	}
+	return convertOpenApiSchema(schema, strings.HasPrefix(doc.OpenApi, "3.1")), nil
+}
+
+// converted schema with the component schemas it may reference as definitions
+func (doc *openApiDocument) schemaLoader(raw json.RawMessage) (gojsonschema.JSONLoader, error) {
+	schema, err := doc.jsonSchema(doc.resolve(raw))
+	if err != nil {
+		return nil, err
+	}
+	if object, ok := schema.(map[string]interface{}); ok && len(doc.definitions) > 0 {
+		object["definitions"] = doc.definitions
+	}
+	return gojsonschema.NewGoLoader(schema), nil
+}
+
+// schema errors as a single error, nil when valid
+func schemaViolation(schema *gojsonschema.Schema, doc string) error {
+	if violations := schemaErrors(schema, doc); len(violations) > 0 {
+		return errors.New(strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// keywords whose value is a schema, a list of them or a map of them
+var (
+	schemaKeywords     = []string{"items", "additionalProperties", "additionalItems", "not", "contains", "propertyNames", "if", "then", "else"}
+	schemaListKeywords = []string{"allOf", "anyOf", "oneOf", "items", "prefixItems"}
+	schemaMapKeywords  = []string{"properties", "patternProperties", "definitions", "$defs", "dependentSchemas"}
+)
+
+// nullable, 3.1 numeric exclusive limits and component references translated; OpenAPI only keywords dropped
+func convertOpenApiSchema(schema interface{}, openApi31 bool) interface{} {
+
+	object, ok := schema.(map[string]interface{})
+	if !ok {
+		return schema
+	}
+
+	if ref, ok := object["$ref"].(string); ok && strings.HasPrefix(ref, "#/components/schemas/") {
+		object["$ref"] = "#/definitions/" + strings.TrimPrefix(ref, "#/components/schemas/")
+	}
+
+	for _, keyword := range schemaKeywords {
+		if child, ok := object[keyword].(map[string]interface{}); ok {
+			object[keyword] = convertOpenApiSchema(child, openApi31)
+		}
+	}
+	for _, keyword := range schemaListKeywords {
+		if children, ok := object[keyword].([]interface{}); ok {
+			for i, child := range children {
+				children[i] = convertOpenApiSchema(child, openApi31)
+			}
+		}
+	}
+	for _, keyword := range schemaMapKeywords {
+		if children, ok := object[keyword].(map[string]interface{}); ok {
+			for name, child := range children {
+				children[name] = convertOpenApiSchema(child, openApi31)
+			}
+		}
+	}
+
+	if openApi31 {
+		for limit, exclusive := range map[string]string{"minimum": "exclusiveMinimum", "maximum": "exclusiveMaximum"} {
+			if value, ok := object[exclusive].(float64); ok {
+				object[limit] = value
+				object[exclusive] = true
+			}
+		}
+	}
+
+	nullable, _ := object["nullable"].(bool)
+	for _, keyword := range openApiOnlyKeywords {
+		delete(object, keyword)
+	}
+	if !nullable {
+		return object
+	}
+	if enum, ok := object["enum"].([]interface{}); ok {
+		object["enum"] = append(enum, nil)
+	}
+	switch kind := object["type"].(type) {
+	case string:
+		object["type"] = []interface{}{kind, "null"}
+		return object
+	case []interface{}:
+		object["type"] = append(kind, "null")
+		return object
+	}
+	return map[string]interface{}{"anyOf": []interface{}{object, map[string]interface{}{"type": "null"}}}
+}
+
+// whole yaml document as json, keeping the order of its keys
+func yamlToJson(data []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return []byte("null"), nil
+	}
+	out := new(bytes.Buffer)
+	if err := writeYamlAsJson(out, document.Content[0]); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
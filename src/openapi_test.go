@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConvertOpenApiSchema(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		schema    string
+		openApi31 bool
+		converted string
+	}{
+		{"plain", `{"type":"string","minLength":1}`, false, `{"minLength":1,"type":"string"}`},
+		{"nullable type", `{"type":"string","nullable":true}`, false, `{"type":["string","null"]}`},
+		{"nullable types", `{"type":["string","integer"],"nullable":true}`, false, `{"type":["string","integer","null"]}`},
+		{"nullable enum", `{"type":"string","enum":["a","b"],"nullable":true}`, false, `{"enum":["a","b",null],"type":["string","null"]}`},
+		{"nullable without type", `{"$ref":"#/components/schemas/Pet","nullable":true}`, false, `{"anyOf":[{"$ref":"#/definitions/Pet"},{"type":"null"}]}`},
+		{"not nullable", `{"type":"string","nullable":false}`, false, `{"type":"string"}`},
+		{"openapi only keywords", `{"type":"object","readOnly":true,"writeOnly":false,"example":{"a":1},"examples":[1],"deprecated":true,"xml":{"name":"x"},"externalDocs":{"url":"u"},"discriminator":{"propertyName":"kind"}}`, false, `{"type":"object"}`},
+		{"component reference", `{"$ref":"#/components/schemas/Pet"}`, false, `{"$ref":"#/definitions/Pet"}`},
+		{"other reference", `{"$ref":"other.json#/Pet"}`, false, `{"$ref":"other.json#/Pet"}`},
+		{"3.0 exclusive limits", `{"type":"number","minimum":1,"exclusiveMinimum":true,"maximum":5,"exclusiveMaximum":false}`, false, `{"exclusiveMaximum":false,"exclusiveMinimum":true,"maximum":5,"minimum":1,"type":"number"}`},
+		{"3.1 exclusive limits", `{"type":"number","exclusiveMinimum":1,"exclusiveMaximum":5}`, true, `{"exclusiveMaximum":true,"exclusiveMinimum":true,"maximum":5,"minimum":1,"type":"number"}`},
+		{"3.1 limits alone", `{"type":"number","minimum":1}`, true, `{"minimum":1,"type":"number"}`},
+		{"nested", `{"type":"object","properties":{"a":{"type":"string","nullable":true,"example":"x"},"l":{"type":"array","items":{"$ref":"#/components/schemas/Pet"}}},"additionalProperties":{"type":"integer","nullable":true}}`, false,
+			`{"additionalProperties":{"type":["integer","null"]},"properties":{"a":{"type":["string","null"]},"l":{"items":{"$ref":"#/definitions/Pet"},"type":"array"}},"type":"object"}`},
+		{"composed", `{"allOf":[{"$ref":"#/components/schemas/Pet"},{"type":"object","nullable":true}],"not":{"readOnly":true}}`, false,
+			`{"allOf":[{"$ref":"#/definitions/Pet"},{"type":["object","null"]}],"not":{}}`},
+		{"boolean schema", `true`, false, `true`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var schema interface{}
+			if err := json.Unmarshal([]byte(test.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			converted, err := json.Marshal(convertOpenApiSchema(schema, test.openApi31))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(converted) != test.converted {
+				t.Errorf("converted\n%s\nwant\n%s", converted, test.converted)
+			}
+		})
+	}
+}
+
+const testOpenApi = `openapi: 3.0.3
+servers:
+  - url: http://api.example.com/v1
+paths:
+  /pets:
+    get:
+      parameters:
+        - {name: kind, in: query, example: cat}
+      responses:
+        "200":
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Pets"}
+              example: {pets: [{name: Tom, tag: null}]}
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/Pet"}
+            examples:
+              tom: {value: {name: Tom}}
+              broken: {value: {tag: x}}
+      responses:
+        "201":
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Pet"}
+              examples:
+                tom: {value: {name: Tom, tag: new}}
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string}
+        tag: {type: string, nullable: true}
+    Pets:
+      type: object
+      properties:
+        pets: {type: array, items: {$ref: "#/components/schemas/Pet"}}
+`
+
+func TestLoadOpenApiRoutes(t *testing.T) {
+
+	routes, err := loadOpenApiRoutes(writeTestFile(t, "api.yaml", testOpenApi), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("%d routes", len(routes))
+	}
+
+	tests := []struct {
+		route    int
+		method   string
+		query    string
+		request  string
+		response string // empty when no fixture
+		valid    bool   // request complies with the operation schema
+	}{
+		{0, "GET", "kind=cat", "", `{"pets":[{"name":"Tom","tag":null}]}`, true},
+		{1, "POST", "", `{"name":"Tom"}`, `{"name":"Tom","tag":"new"}`, true},
+		{1, "POST", "", `{"tag":"x"}`, "", false},
+		{1, "POST", "", `{"name":"Tom","tag":null}`, "", true},
+	}
+	for _, test := range tests {
+		route := routes[test.route]
+		if route.method != test.method || route.path != "/v1/pets" {
+			t.Errorf("route %d is %s %s", test.route, route.method, route.path)
+		}
+		var request []byte
+		if len(test.request) > 0 {
+			request = []byte(test.request)
+		}
+		entry := route.fixtures.lookup(test.query, request)
+		if (entry == nil) != (len(test.response) == 0) || (entry != nil && string(entry.response) != test.response) {
+			t.Errorf("%s [%s]%s answered %+v, want %s", test.method, test.query, test.request, entry, test.response)
+		}
+		if len(test.request) > 0 {
+			if valid := schemaViolation(route.reqSchema, test.request) == nil; valid != test.valid {
+				t.Errorf("%s %s valid %t, want %t", test.method, test.request, valid, test.valid)
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// PactProvider name of the provider at exported contracts
+var PactProvider = "JsonMock"
+
+// PactPath request path at exported contracts, the mock doesn't care about it
+var PactPath = "/"
+
+// only the Pact v2/v3 fields needed to build fixtures
+type pactContract struct {
+	Consumer struct {
+		Name string `json:"name"`
+	} `json:"consumer"`
+	Provider struct {
+		Name string `json:"name"`
+	} `json:"provider"`
+	Interactions []pactInteraction `json:"interactions"`
+	Metadata     struct {
+		PactSpecification struct {
+			Version string `json:"version"`
+		} `json:"pactSpecification"`
+	} `json:"metadata"`
+}
+
+type pactInteraction struct {
+	Description string `json:"description"`
+	Request     struct {
+		Method  string            `json:"method"`
+		Path    string            `json:"path"`
+		Query   json.RawMessage   `json:"query,omitempty"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Body    json.RawMessage   `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status  int               `json:"status"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Body    json.RawMessage   `json:"body,omitempty"`
+	} `json:"response"`
+}
+
+// successful interactions with json bodies
+func importPact(data []byte) ([]importedEntry, []string, error) {
+
+	var entries []importedEntry
+	var skipped []string
+
+	var contract pactContract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		return entries, skipped, err
+	}
+
+	debugRegexp := regexp.MustCompile("^" + DebugParameter + "")
+	for i, interaction := range contract.Interactions {
+		origin := "interaction " + strconv.Itoa(i+1) + " " + interaction.Description
+		if interaction.Response.Status != http.StatusOK {
+			skipped = append(skipped, origin+": status "+strconv.Itoa(interaction.Response.Status))
+			continue
+		}
+		// GET and friends: an empty request, as body-less requests are looked up
+		request := []byte(interaction.Request.Body)
+		if len(request) == 0 || string(request) == "null" {
+			request = []byte(emptyRequest)
+		}
+		values, err := pactQueryValues(interaction.Request.Query)
+		if err != nil {
+			skipped = append(skipped, origin+": query "+err.Error())
+			continue
+		}
+		entries = append(entries, importedEntry{
+			origin:   origin,
+			query:    orderQueryByParams(QueryValuesAsString(values), debugRegexp),
+			request:  request,
+			response: interaction.Response.Body,
+		})
+	}
+	return entries, skipped, nil
+}
+
+// v3 query is an object of lists, v2 just the query string
+func pactQueryValues(raw json.RawMessage) (url.Values, error) {
+	values := url.Values{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return values, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		// as written at the url, v3 lists are already decoded
+		for _, param := range unescapeQueryParams(parseQueryText(text)) {
+			// a flag is an empty value, as the mock keys ?x
+			value := ""
+			if param.Value != nil {
+				value = *param.Value
+			}
+			values.Add(param.Key, value)
+		}
+		return values, nil
+	}
+	var params map[string][]string
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return values, err
+	}
+	for key, list := range params {
+		if len(list) == 0 {
+			// a flag as well
+			list = []string{""}
+		}
+		values[key] = append([]string{}, list...)
+	}
+	return values, nil
+}
+
+// one POST interaction per entry, answered with 200
+func exportPact(entries []exportedEntry, name string) ([]byte, error) {
+
+	var contract pactContract
+	contract.Consumer.Name = name
+	contract.Provider.Name = PactProvider
+	contract.Metadata.PactSpecification.Version = "3.0.0"
+	contract.Interactions = []pactInteraction{}
+
+	for i, entry := range entries {
+		var interaction pactInteraction
+		interaction.Description = "entry " + strconv.Itoa(i+1)
+		interaction.Request.Method = http.MethodPost
+		interaction.Request.Path = PactPath
+		interaction.Request.Headers = map[string]string{"Content-Type": "application/json"}
+		interaction.Request.Body = json.RawMessage(entry.request)
+		if len(entry.query) > 0 {
+			// flags become empty values
+			params := make(map[string][]string)
+			for _, param := range parseQueryText(entry.query) {
+				value := ""
+				if param.Value != nil {
+					value = *param.Value
+				}
+				params[param.Key] = append(params[param.Key], value)
+			}
+			query, err := json.Marshal(params)
+			if err != nil {
+				return nil, err
+			}
+			interaction.Request.Query = query
+		}
+		interaction.Response.Status = http.StatusOK
+		interaction.Response.Headers = map[string]string{"Content-Type": "application/json"}
+		interaction.Response.Body = json.RawMessage(entry.response)
+		contract.Interactions = append(contract.Interactions, interaction)
+	}
+
+	out := new(bytes.Buffer)
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(contract); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
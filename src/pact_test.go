@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPactRoundTrip(t *testing.T) {
+
+	data, err := exportPact(testExportedEntries, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contract pactContract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		t.Fatal(err)
+	}
+	// v3 queries keep the decoded values
+	if query, _ := compactObject(contract.Interactions[1].Request.Query); query != `{"a":["1"],"b":["x y"]}` {
+		t.Errorf("query %s", query)
+	}
+
+	entries, skipped, err := importPact(data)
+	if err != nil || len(skipped) > 0 {
+		t.Fatal(err, skipped)
+	}
+	assertRoundTrip(t, entries)
+}
+
+func TestPactQueryValues(t *testing.T) {
+	tests := []struct {
+		raw    string
+		values map[string][]string
+	}{
+		{``, map[string][]string{}},
+		{`"b=2&a=1&a=3"`, map[string][]string{"a": {"1", "3"}, "b": {"2"}}},
+		{`"q=x%20y&name=Jos%C3%A9&flag"`, map[string][]string{"q": {"x y"}, "name": {"José"}, "flag": {""}}},
+		{`{"q":["x%20y"]}`, map[string][]string{"q": {"x%20y"}}},
+		{`{"flag":[],"a":["1"]}`, map[string][]string{"flag": {""}, "a": {"1"}}},
+	}
+	for _, test := range tests {
+		values, err := pactQueryValues(json.RawMessage(test.raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(map[string][]string(values), test.values) {
+			t.Errorf("%s: values %v, want %v", test.raw, values, test.values)
+		}
+	}
+}
+
+const testPactServed = `{"consumer":{"name":"c"},"provider":{"name":"p"},"interactions":[
+{"description":"v2","request":{"method":"POST","path":"/x","query":"a=1&x","body":{"id":"1"}},"response":{"status":200,"body":{"id":"1"}}},
+{"description":"v3","request":{"method":"POST","path":"/x","query":{"flag":[],"b":["2"]},"body":{"id":"2"}},"response":{"status":200,"body":{"id":"2"}}},
+{"description":"no body","request":{"method":"GET","path":"/x","query":"id=3"},"response":{"status":200,"body":{"id":"3"}}},
+{"description":"null body","request":{"method":"GET","path":"/x","query":"id=4","body":null},"response":{"status":200,"body":{"id":"4"}}}
+]}`
+
+func TestImportPactServed(t *testing.T) {
+
+	candidates, skipped, err := importPact([]byte(testPactServed))
+	if err != nil || len(skipped) > 0 {
+		t.Fatal(err, skipped)
+	}
+	// body-less requests become empty ones, as HAR and Postman imports do
+	if string(candidates[2].request) != emptyRequest || string(candidates[3].request) != emptyRequest {
+		t.Errorf("body-less requests imported as %s and %s", candidates[2].request, candidates[3].request)
+	}
+	assertServed(t, serveImported(t, candidates), []servedTest{
+		{"POST", "/x?a=1&x", `{"id":"1"}`, `{"id":"1"}`},
+		{"POST", "/x?x=&a=1", `{"id":"1"}`, `{"id":"1"}`},
+		{"POST", "/x?b=2&flag", `{"id":"2"}`, `{"id":"2"}`},
+		{"GET", "/x?id=3", "", `{"id":"3"}`},
+		{"GET", "/x?id=4", "{ }", `{"id":"4"}`},
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// PassThrough routes for requests without fixture, by path prefix
+var PassThrough = passThroughFlag{}
+
+// PassThroughRecord appends pass-through answers to -recordMap as well
+var PassThroughRecord = false
+
+// where requests without fixture under a path prefix are sent to
+type passThroughRoute struct {
+	prefix   string
+	upstream string
+}
+
+// -passThrough can be repeated: [<path prefix>=]<upstream url>, every path when no prefix
+type passThroughFlag []passThroughRoute
+
+func (p *passThroughFlag) String() string {
+	return strings.Join(p.values(), ",")
+}
+
+func (p *passThroughFlag) values() []string {
+	var routes []string
+	for _, route := range *p {
+		routes = append(routes, route.prefix+"="+route.upstream)
+	}
+	return routes
+}
+
+func (p *passThroughFlag) Set(value string) error {
+	route := passThroughRoute{prefix: "/", upstream: value}
+	if strings.HasPrefix(value, "/") {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || len(parts[1]) == 0 {
+			return errors.New("expected <path prefix>=<upstream url>")
+		}
+		route = passThroughRoute{prefix: parts[0], upstream: parts[1]}
+	}
+	if !strings.HasPrefix(route.upstream, "http://") && !strings.HasPrefix(route.upstream, "https://") {
+		return errors.New("upstream must be an http or https url: " + route.upstream)
+	}
+	*p = append(*p, route)
+	return nil
+}
+
+// handlers of the -passThrough flags, nil for none; answers recorded into recordMockFile
+func passThroughFromFlags(recordMockFile string) ([]*upstreamHandler, error) {
+	if len(PassThrough) == 0 {
+		return nil, nil
+	}
+	var rec *recorder
+	if PassThroughRecord {
+		var err error
+		if rec, err = newRecorder(recordMockFile); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Requests without fixture passed through to "+PassThrough.String()+" -passThroughRecord=%t", PassThroughRecord)
+	return newPassThroughHandlers(PassThrough, rec), nil
+}
+
+// one upstream handler per route, longest prefixes first; no contract checks, those apis are not mocked
+func newPassThroughHandlers(routes passThroughFlag, rec *recorder) []*upstreamHandler {
+	var handlers []*upstreamHandler
+	for _, route := range routes {
+		handlers = append(handlers, &upstreamHandler{
+			upstream: strings.TrimSuffix(route.upstream, "/"),
+			routed:   true,
+			prefix:   strings.TrimSuffix(route.prefix, "/"),
+			client:   &http.Client{Timeout: UpstreamTimeout},
+			recorder: rec,
+		})
+	}
+	sort.SliceStable(handlers, func(i, j int) bool { return len(handlers[i].prefix) > len(handlers[j].prefix) })
+	return handlers
+}
+
+// forward a request without fixture when its path is routed; false when nobody took it
+func (c *customHandler) forwardUnmatched(w http.ResponseWriter, r *http.Request, query string, body []byte, debug bool) bool {
+	for _, handler := range c.passThrough {
+		if r.URL.Path == handler.prefix || strings.HasPrefix(r.URL.Path, handler.prefix+"/") {
+			handler.forward(w, r, query, body, debug)
+			return true
+		}
+	}
+	return false
+}
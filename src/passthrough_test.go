@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPassThroughFlag(t *testing.T) {
+	tests := []struct {
+		value string
+		route passThroughRoute
+		err   bool
+	}{
+		{"http://api", passThroughRoute{prefix: "/", upstream: "http://api"}, false},
+		{"/orders=https://orders/v1", passThroughRoute{prefix: "/orders", upstream: "https://orders/v1"}, false},
+		{"/orders=", passThroughRoute{}, true},
+		{"/orders", passThroughRoute{}, true},
+		{"orders=http://api", passThroughRoute{}, true},
+		{"ftp://api", passThroughRoute{}, true},
+	}
+	for _, test := range tests {
+		var routes passThroughFlag
+		err := routes.Set(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.value, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(routes[0], test.route) {
+			t.Errorf("%s: route %+v, want %+v", test.value, routes[0], test.route)
+		}
+	}
+}
+
+func TestPassThroughRouting(t *testing.T) {
+
+	orders, other := &testUpstream{}, &testUpstream{}
+	ordersServer, otherServer := httptest.NewServer(orders), httptest.NewServer(other)
+	defer ordersServer.Close()
+	defer otherServer.Close()
+
+	var routes passThroughFlag
+	for _, value := range []string{otherServer.URL + "/", "/orders=" + ordersServer.URL + "/v1"} {
+		if err := routes.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, req, _ := writeTestSchemas(t)
+	reqSchema, err := loadSchemaFile(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := newRequestResponseMap(0)
+	fixtures.Add(`{"id":"1"}`, QueryResponse{response: `{"id":"fixture"}`})
+	handler := &customHandler{rrmap: fixtures, reqSchema: reqSchema, passThrough: newPassThroughHandlers(routes, nil)}
+
+	tests := []struct {
+		method   string
+		target   string
+		body     string
+		upstream *testUpstream // nil when the mock answers
+		path     string
+	}{
+		{"POST", "/orders/1", `{"id":"1"}`, nil, ""},
+		{"POST", "/orders/1?a=1", `{"id":"2"}`, orders, "/v1/1"},
+		{"POST", "/orders", `{"id":2}`, orders, "/v1"},
+		{"GET", "/orders/2", "", orders, "/v1/2"},
+		{"POST", "/ordersArchive", `{"id":"2"}`, other, "/ordersArchive"},
+		{"GET", "/pets", "", other, "/pets"},
+	}
+	for _, test := range tests {
+		*orders = testUpstream{status: http.StatusOK, answer: `{"id":"orders"}`}
+		*other = testUpstream{status: http.StatusOK, answer: `{"id":"other"}`}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(test.method, test.target, bytes.NewBufferString(test.body)))
+
+		if test.upstream == nil {
+			if orders.calls+other.calls > 0 || w.Body.String() != `{"id":"fixture"}` {
+				t.Errorf("%s %s passed through, answered %s", test.method, test.target, w.Body.String())
+			}
+			continue
+		}
+		if test.upstream.calls != 1 || orders.calls+other.calls != 1 || test.upstream.path != test.path || test.upstream.body != test.body {
+			t.Errorf("%s %s: upstream got %d calls at %s with %s, want %s", test.method, test.target, test.upstream.calls, test.upstream.path, test.upstream.body, test.path)
+		}
+		if w.Code != http.StatusOK || w.Body.String() != test.upstream.answer {
+			t.Errorf("%s %s answered %d %s", test.method, test.target, w.Code, w.Body.String())
+		}
+	}
+
+	// nothing routed there
+	handler.passThrough = newPassThroughHandlers(routes[1:], nil)
+	*other = testUpstream{}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/pets", bytes.NewBufferString(`{"id":"3"}`)))
+	if other.calls > 0 || w.Code != http.StatusNoContent {
+		t.Errorf("unrouted request answered %d", w.Code)
+	}
+}
+
+func TestPassThroughRecord(t *testing.T) {
+
+	backend := &testUpstream{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	var routes passThroughFlag
+	if err := routes.Set("/api=" + server.URL); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "recorded.jsonl")
+	rec, err := newRecorder(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, req, _ := writeTestSchemas(t)
+	reqSchema, err := loadSchemaFile(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := newRequestResponseMap(0)
+	fixtures.Add(`{"id":"fixture"}`, QueryResponse{response: `{}`})
+	handler := &customHandler{rrmap: fixtures, reqSchema: reqSchema, passThrough: newPassThroughHandlers(routes, rec)}
+
+	tests := []struct {
+		target string
+		body   string
+		status int
+		answer string
+	}{
+		{"/api/x?b=2&a=1", `{ "id": "1" }`, 200, `{"n": 1}`},
+		{"/api/x", `{"id":"2"}`, 404, `{"error":"missing"}`},
+		{"/api/x", `{"id":"3"}`, 200, `[1]`},
+		{"/api/y?a=1&b=2", `{"id":"1"}`, 200, `{"n":2}`},
+		{"/api/x", `{"other":true}`, 200, `{"n":3}`},
+	}
+	for _, test := range tests {
+		*backend = testUpstream{status: test.status, answer: test.answer}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", test.target, bytes.NewBufferString(test.body)))
+	}
+
+	// only successful json objects, once per key; pass-through apis have no contract to comply with
+	var recorded []string
+	err = forEachMockEntry(file, nil, func(query string, request string, response string) {
+		recorded = append(recorded, query+" "+request+" "+response)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`a=1&b=2 {"id":"1"} {"n":1}`, ` {"other":true} {"n":3}`}
+	if !reflect.DeepEqual(recorded, want) {
+		t.Errorf("recorded %q, want %q", recorded, want)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PostmanSchema collection format being imported and exported
+var PostmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// PostmanBaseUrl default value of the {{baseUrl}} variable of exported collections
+var PostmanBaseUrl = "http://localhost"
+
+// only the Postman v2.1 fields needed to build fixtures
+type postmanCollection struct {
+	Info struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable,omitempty"`
+}
+
+// either a folder with more items or a request with its saved examples
+type postmanItem struct {
+	Name     string            `json:"name"`
+	Item     []postmanItem     `json:"item,omitempty"`
+	Request  *postmanRequest   `json:"request,omitempty"`
+	Response []postmanResponse `json:"response,omitempty"`
+}
+
+type postmanRequest struct {
+	Method string          `json:"method"`
+	Header []postmanHeader `json:"header"`
+	URL    postmanURL      `json:"url"`
+	Body   *postmanBody    `json:"body,omitempty"`
+}
+
+type postmanResponse struct {
+	Name            string          `json:"name"`
+	OriginalRequest *postmanRequest `json:"originalRequest,omitempty"`
+	Status          string          `json:"status,omitempty"`
+	Code            int             `json:"code,omitempty"`
+	Header          []postmanHeader `json:"header,omitempty"`
+	Body            string          `json:"body"`
+}
+
+type postmanHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// nil value for flags without value
+type postmanQuery struct {
+	Key      string  `json:"key"`
+	Value    *string `json:"value"`
+	Disabled bool    `json:"disabled,omitempty"`
+}
+
+type postmanURL struct {
+	Raw   string         `json:"raw"`
+	Host  []string       `json:"host,omitempty"`
+	Query []postmanQuery `json:"query,omitempty"`
+}
+
+// urls might be just a string
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &u.Raw)
+	}
+	type plain postmanURL
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+type postmanBody struct {
+	Mode    string              `json:"mode"`
+	Raw     string              `json:"raw"`
+	Options *postmanBodyOptions `json:"options,omitempty"`
+}
+
+type postmanBodyOptions struct {
+	Raw struct {
+		Language string `json:"language"`
+	} `json:"raw"`
+}
+
+// saved example responses of every request, as pairs
+func importPostman(data []byte) ([]importedEntry, []string, error) {
+
+	var entries []importedEntry
+	var skipped []string
+
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return entries, skipped, err
+	}
+
+	debugRegexp := regexp.MustCompile("^" + DebugParameter + "")
+	var walk func(items []postmanItem, folder string)
+	walk = func(items []postmanItem, folder string) {
+		for _, item := range items {
+			origin := folder + item.Name
+			if item.Request == nil {
+				walk(item.Item, origin+"/")
+				continue
+			}
+			if len(item.Response) == 0 {
+				skipped = append(skipped, origin+": without saved example responses")
+				continue
+			}
+			for i, example := range item.Response {
+				exampleOrigin := origin + " example " + strconv.Itoa(i+1) + " " + example.Name
+				if example.Code != 0 && example.Code != http.StatusOK {
+					skipped = append(skipped, exampleOrigin+": status "+strconv.Itoa(example.Code))
+					continue
+				}
+				// what was really sent for that example
+				request := item.Request
+				if example.OriginalRequest != nil {
+					request = example.OriginalRequest
+				}
+				// GET and friends: an empty request, as body-less requests are looked up
+				body := []byte(emptyRequest)
+				if request.Body != nil && (len(request.Body.Mode) > 0 || len(request.Body.Raw) > 0) {
+					if request.Body.Mode != "raw" {
+						skipped = append(skipped, exampleOrigin+": request without raw body")
+						continue
+					}
+					if len(strings.TrimSpace(request.Body.Raw)) > 0 {
+						body = []byte(request.Body.Raw)
+					}
+				}
+				entries = append(entries, importedEntry{
+					origin:   exampleOrigin,
+					query:    orderQueryByParams(QueryValuesAsString(request.URL.values()), debugRegexp),
+					request:  body,
+					response: []byte(example.Body),
+				})
+			}
+		}
+	}
+	walk(collection.Item, "")
+	return entries, skipped, nil
+}
+
+// enabled query params, from the raw url when not detailed
+func (u postmanURL) values() url.Values {
+	values := url.Values{}
+	query := u.Query
+	if len(query) == 0 {
+		if at := strings.Index(u.Raw, "?"); at >= 0 {
+			query = parseQueryText(u.Raw[at+1:])
+		}
+	}
+	for _, param := range unescapeQueryParams(query) {
+		if param.Disabled {
+			continue
+		}
+		// a flag is an empty value, as the mock keys ?x
+		value := ""
+		if param.Value != nil {
+			value = *param.Value
+		}
+		values.Add(param.Key, value)
+	}
+	return values
+}
+
+// query text as it was written, without decoding it; flags don't have value
+func parseQueryText(query string) []postmanQuery {
+	var params []postmanQuery
+	for _, param := range strings.Split(query, "&") {
+		if len(param) == 0 {
+			continue
+		}
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) == 1 {
+			params = append(params, postmanQuery{Key: parts[0]})
+			continue
+		}
+		value := parts[1]
+		params = append(params, postmanQuery{Key: parts[0], Value: &value})
+	}
+	return params
+}
+
+// url query params decoded, as the mock sees them; written as they were when not well escaped
+func unescapeQueryParams(params []postmanQuery) []postmanQuery {
+	unescaped := make([]postmanQuery, len(params))
+	for i, param := range params {
+		unescaped[i] = param
+		if key, err := url.QueryUnescape(param.Key); err == nil {
+			unescaped[i].Key = key
+		}
+		if param.Value != nil {
+			if value, err := url.QueryUnescape(*param.Value); err == nil {
+				unescaped[i].Value = &value
+			}
+		}
+	}
+	return unescaped
+}
+
+// params of a mock query, already decoded, escaped to be written into a url
+func escapeQueryParams(params []postmanQuery) []postmanQuery {
+	escaped := make([]postmanQuery, len(params))
+	for i, param := range params {
+		escaped[i] = postmanQuery{Key: url.QueryEscape(param.Key), Disabled: param.Disabled}
+		if param.Value != nil {
+			value := url.QueryEscape(*param.Value)
+			escaped[i].Value = &value
+		}
+	}
+	return escaped
+}
+
+// escaped params back into the query text of a url
+func queryText(params []postmanQuery) string {
+	var query strings.Builder
+	for _, param := range params {
+		if query.Len() > 0 {
+			query.WriteByte('&')
+		}
+		query.WriteString(param.Key)
+		if param.Value != nil {
+			query.WriteByte('=')
+			query.WriteString(*param.Value)
+		}
+	}
+	return query.String()
+}
+
+// one POST request per entry, its answer as saved example
+func exportPostman(entries []exportedEntry, name string) ([]byte, error) {
+
+	var collection postmanCollection
+	collection.Info.Name = name
+	collection.Info.Schema = PostmanSchema
+	collection.Variable = []postmanVariable{{Key: "baseUrl", Value: PostmanBaseUrl}}
+
+	for i, entry := range entries {
+		raw := "{{baseUrl}}"
+		query := escapeQueryParams(parseQueryText(entry.query))
+		if len(query) > 0 {
+			raw += "?" + queryText(query)
+		}
+		body := &postmanBody{Mode: "raw", Raw: entry.request}
+		body.Options = &postmanBodyOptions{}
+		body.Options.Raw.Language = "json"
+		request := &postmanRequest{
+			Method: http.MethodPost,
+			Header: []postmanHeader{{Key: "Content-Type", Value: "application/json"}},
+			URL:    postmanURL{Raw: raw, Host: []string{"{{baseUrl}}"}, Query: query},
+			Body:   body,
+		}
+		itemName := "entry " + strconv.Itoa(i+1)
+		collection.Item = append(collection.Item, postmanItem{
+			Name:    itemName,
+			Request: request,
+			Response: []postmanResponse{{
+				Name:            itemName,
+				OriginalRequest: request,
+				Status:          "OK",
+				Code:            http.StatusOK,
+				Header:          []postmanHeader{{Key: "Content-Type", Value: "application/json"}},
+				Body:            entry.response,
+			}},
+		})
+	}
+
+	out := new(bytes.Buffer)
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(collection); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
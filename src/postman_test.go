@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fixtures as the mock keeps them: decoded query values, compacted json
+var testExportedEntries = []exportedEntry{
+	{query: "", request: `{"id":"1"}`, response: `{"id":"1"}`},
+	{query: "a=1&b=x y", request: `{"id":"2"}`, response: `{"id":"2"}`},
+	{query: "q=a=b,50%", request: `{"id":"3"}`, response: `{"id":"3"}`},
+	{query: "name=José/+", request: `{"id":"4"}`, response: `{"id":"4"}`},
+}
+
+func TestPostmanRoundTrip(t *testing.T) {
+
+	data, err := exportPostman(testExportedEntries, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		t.Fatal(err)
+	}
+	raws := []string{
+		"{{baseUrl}}",
+		"{{baseUrl}}?a=1&b=x+y",
+		"{{baseUrl}}?q=a%3Db%2C50%25",
+		"{{baseUrl}}?name=Jos%C3%A9%2F%2B",
+	}
+	debugRegexp := regexp.MustCompile("^" + DebugParameter + "")
+	for i, item := range collection.Item {
+		if item.Request.URL.Raw != raws[i] {
+			t.Errorf("url %s, want %s", item.Request.URL.Raw, raws[i])
+		}
+		// the very same key once requested
+		sent, err := url.Parse(strings.Replace(item.Request.URL.Raw, "{{baseUrl}}", PostmanBaseUrl, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query := orderQueryByParams(QueryValuesAsString(sent.Query()), debugRegexp); query != testExportedEntries[i].query {
+			t.Errorf("%s requested as %q, want %q", item.Request.URL.Raw, query, testExportedEntries[i].query)
+		}
+	}
+
+	entries, skipped, err := importPostman(data)
+	if err != nil || len(skipped) > 0 {
+		t.Fatal(err, skipped)
+	}
+	assertRoundTrip(t, entries)
+}
+
+func TestPostmanQueryFromRawUrl(t *testing.T) {
+	tests := []struct {
+		raw   string
+		query string
+	}{
+		{"{{baseUrl}}/x?b=2&a=1", "a=1&b=2"},
+		{"http://api/x?q=a%20b&flag", "flag=&q=a b"},
+		{"http://api/x?bad=100%", "bad=100%"},
+	}
+	debugRegexp := regexp.MustCompile("^" + DebugParameter + "")
+	for _, test := range tests {
+		if got := orderQueryByParams(QueryValuesAsString(postmanURL{Raw: test.raw}.values()), debugRegexp); got != test.query {
+			t.Errorf("%s: query %q, want %q", test.raw, got, test.query)
+		}
+	}
+}
+
+// imported back just like the exported ones
+func assertRoundTrip(t *testing.T, entries []importedEntry) {
+	t.Helper()
+	if len(entries) != len(testExportedEntries) {
+		t.Fatalf("%d entries imported, want %d", len(entries), len(testExportedEntries))
+	}
+	for i, entry := range entries {
+		want := testExportedEntries[i]
+		// compacted later on, as any imported entry
+		request, _ := compactObject(entry.request)
+		response, _ := compactObject(entry.response)
+		got := exportedEntry{query: entry.query, request: request, response: response}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("entry %d imported as %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+const testPostmanServed = `{"info":{"name":"flags","schema":"https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},"item":[
+{"name":"detailed","request":{"method":"POST","url":{"raw":"{{baseUrl}}/x?a=1&x","query":[{"key":"a","value":"1"},{"key":"x"}]},"body":{"mode":"raw","raw":"{\"id\":\"1\"}"}},
+ "response":[{"name":"ok","code":200,"body":"{\"id\":\"1\"}"}]},
+{"name":"raw","request":{"method":"POST","url":"{{baseUrl}}/x?flag&b=2","body":{"mode":"raw","raw":"{\"id\":\"2\"}"}},
+ "response":[{"name":"ok","code":200,"body":"{\"id\":\"2\"}"}]},
+{"name":"no body","request":{"method":"GET","url":"{{baseUrl}}/x?id=3"},
+ "response":[{"name":"ok","code":200,"body":"{\"id\":\"3\"}"}]},
+{"name":"empty body","request":{"method":"GET","url":"{{baseUrl}}/x?id=4","body":{"mode":"raw","raw":""}},
+ "response":[{"name":"ok","code":200,"body":"{\"id\":\"4\"}"}]},
+{"name":"form","request":{"method":"POST","url":"{{baseUrl}}/x","body":{"mode":"urlencoded"}},
+ "response":[{"name":"ok","code":200,"body":"{\"id\":\"5\"}"}]}
+]}`
+
+func TestImportPostmanServed(t *testing.T) {
+
+	candidates, skipped, err := importPostman([]byte(testPostmanServed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"form example 1 ok: request without raw body"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped %q, want %q", skipped, want)
+	}
+	// body-less requests become empty ones, as HAR and Pact imports do
+	if string(candidates[2].request) != emptyRequest || string(candidates[3].request) != emptyRequest {
+		t.Errorf("body-less requests imported as %s and %s", candidates[2].request, candidates[3].request)
+	}
+	assertServed(t, serveImported(t, candidates), []servedTest{
+		{"POST", "/x?a=1&x", `{"id":"1"}`, `{"id":"1"}`},
+		{"POST", "/x?x&a=1", `{"id":"1"}`, `{"id":"1"}`},
+		{"POST", "/x?b=2&flag=", `{"id":"2"}`, `{"id":"2"}`},
+		{"GET", "/x?id=3", "", `{"id":"3"}`},
+		{"GET", "/x?id=4", "{}", `{"id":"4"}`},
+	})
+}
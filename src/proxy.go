@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ProxyUpstream real backend to be validated, empty means no proxy mode
+var ProxyUpstream = ""
+
+// ProxyStrict answers 502 when the real backend breaks its contract
+var ProxyStrict = false
+
+// UpstreamTimeout to wait for a real backend
+var UpstreamTimeout = 30 * time.Second
+
+// hop-by-hop headers are not forwarded; neither Accept-Encoding, so the upstream answer can be read
+var notForwardedHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Accept-Encoding", "Content-Length"}
+
+// forwards requests to a real backend checking both sides against their schemas
+type upstreamHandler struct {
+	upstream   string
+	routed     bool // passing through, path after prefix is appended to the upstream url
+	prefix     string
+	reqSchema  *gojsonschema.Schema
+	resSchema  *gojsonschema.Schema
+	client     *http.Client
+	strict     bool
+	recorder   *recorder
+	requests   uint64
+	violations uint64
+}
+
+// upstream handler validating against the usual schemas
+func newUpstreamHandler(upstream string, requestJsonSchemaFile string, responseJsonSchemaFile string) (*upstreamHandler, error) {
+
+	req, err := loadSchemaFile(requestJsonSchemaFile)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Unable to read Request Json Schema File.")
+	}
+	res, err := loadSchemaFile(responseJsonSchemaFile)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Unable to read Response Json Schema File.")
+	}
+
+	return &upstreamHandler{
+		upstream:  upstream,
+		reqSchema: req,
+		resSchema: res,
+		client:    &http.Client{Timeout: UpstreamTimeout},
+	}, nil
+}
+
+// forward to the real backend and answer back, checking its contract on the way
+func (u *upstreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, query string, debug bool) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		if debug {
+			log.Println(err)
+		}
+		return
+	}
+	u.forward(w, r, query, body, debug)
+}
+
+// body already read by the caller
+func (u *upstreamHandler) forward(w http.ResponseWriter, r *http.Request, query string, body []byte, debug bool) {
+
+	requests := atomic.AddUint64(&u.requests, 1)
+
+	// client side of the contract
+	reqViolations := u.violated(u.reqSchema, "Request", body)
+	if len(reqViolations) > 0 && u.strict {
+		http.Error(w, "Body Json Request doesn't comply with its expected Json Schema", http.StatusUnprocessableEntity)
+		return
+	}
+
+	upstream := u.upstream
+	if u.routed {
+		upstream += strings.TrimPrefix(r.URL.Path, u.prefix)
+	}
+	response, answer, err := forwardRequest(u.client, upstream, r, body)
+	if err != nil {
+		http.Error(w, "unable to reach upstream: "+err.Error(), http.StatusBadGateway)
+		log.Println("Upstream: " + err.Error())
+		return
+	}
+	if debug {
+		log.Printf("Upstream: [%s]%s -> %d %s\n", query, string(body), response.StatusCode, string(answer))
+	}
+
+	// server side of the contract, only for successful answers
+	var resViolations []string
+	if response.StatusCode == http.StatusOK {
+		resViolations = u.violated(u.resSchema, "Response", answer)
+		if len(resViolations) > 0 && u.strict {
+			http.Error(w, "Upstream Json Response doesn't comply with its expected Json Schema", http.StatusBadGateway)
+			return
+		}
+	}
+	writeUpstreamResponse(w, response, answer)
+
+	if debug || requests%1000 == 0 {
+		log.Printf("Upstream: %d requests, %d contract violations\n", requests, atomic.LoadUint64(&u.violations))
+	}
+
+	// only what the mock is able to answer back later on
+	if u.recorder == nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		log.Printf("Record: upstream answered %d, not recorded\n", response.StatusCode)
+		return
+	}
+	// the loader would ignore it anyway
+	if len(reqViolations) > 0 || len(resViolations) > 0 {
+		log.Println("Record: exchange doesn't comply with its Json Schemas, not recorded")
+		return
+	}
+	request, err := compactObject(body)
+	if err != nil {
+		log.Println("Record: request is not a json object, not recorded")
+		return
+	}
+	result, err := compactObject(answer)
+	if err != nil {
+		log.Println("Record: response is not a json object, not recorded")
+		return
+	}
+	u.recorder.record(query, request, result, debug)
+}
+
+// log and count contract violations
+func (u *upstreamHandler) violated(schema *gojsonschema.Schema, side string, doc []byte) []string {
+	if schema == nil {
+		return nil
+	}
+	violations := schemaErrors(schema, string(doc))
+	if len(violations) > 0 {
+		total := atomic.AddUint64(&u.violations, 1)
+		log.Printf("Upstream: %s doesn't comply with its Json Schema (%d violations so far): %s\n", side, total, strings.Join(violations, "; "))
+	}
+	return violations
+}
+
+// forward a request to the upstream url, with the same method, query, headers and body
+func forwardRequest(client *http.Client, upstream string, r *http.Request, body []byte) (*http.Response, []byte, error) {
+
+	target := upstream
+	// who the client is is told by its certificate only, never by the client itself
+	rawQuery := withoutQueryParam(r.URL.RawQuery, TLSClientParam)
+	if len(rawQuery) > 0 {
+		if strings.HasSuffix(upstream, "?") {
+			target += rawQuery
+		} else if strings.Contains(upstream, "?") {
+			target += "&" + rawQuery
+		} else {
+			target += "?" + rawQuery
+		}
+	}
+
+	request, err := http.NewRequest(r.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range r.Header {
+		request.Header[name] = values
+	}
+	for _, name := range notForwardedHeaders {
+		request.Header.Del(name)
+	}
+	request.ContentLength = int64(len(body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	answer, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response, nil, err
+	}
+	return response, answer, nil
+}
+
+// raw query without a param, the rest kept as it was written
+func withoutQueryParam(rawQuery string, name string) string {
+	if len(name) == 0 || len(rawQuery) == 0 {
+		return rawQuery
+	}
+	var kept []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		key := strings.SplitN(param, "=", 2)[0]
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if key != name {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// send back the upstream answer as it was received
+func writeUpstreamResponse(w http.ResponseWriter, response *http.Response, body []byte) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	for _, name := range notForwardedHeaders {
+		w.Header().Del(name)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(response.StatusCode)
+	w.Write(body)
+}
+
+// compact json that must be an object, as req and res elements
+func compactObject(raw []byte) (string, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return "", errors.New("not a json object")
+	}
+	compacted := new(bytes.Buffer)
+	if err := json.Compact(compacted, trimmed); err != nil {
+		return "", err
+	}
+	return compacted.String(), nil
+}
+
+// schema errors of a document, empty when valid
+func schemaErrors(schema *gojsonschema.Schema, doc string) []string {
+	var violations []string
+	result, err := schema.Validate(gojsonschema.NewStringLoader(doc))
+	if err != nil {
+		return append(violations, err.Error())
+	}
+	for _, desc := range result.Errors() {
+		violations = append(violations, desc.String())
+	}
+	return violations
+}
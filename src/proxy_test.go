@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// real backend answering whatever it is told, remembering what it got
+type testUpstream struct {
+	status   int
+	answer   string
+	method   string
+	path     string
+	rawQuery string
+	body     string
+	calls    int
+}
+
+func (u *testUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	u.method, u.path, u.rawQuery, u.body = r.Method, r.URL.Path, r.URL.RawQuery, string(body)
+	u.calls++
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(u.status)
+	w.Write([]byte(u.answer))
+}
+
+func TestUpstreamForward(t *testing.T) {
+
+	defer func(param string) { TLSClientParam = param }(TLSClientParam)
+	TLSClientParam = "client"
+
+	backend := &testUpstream{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	_, req, res := writeTestSchemas(t)
+
+	tests := []struct {
+		name     string
+		strict   bool
+		target   string
+		body     string
+		status   int    // upstream answer
+		answer   string // upstream answer
+		code     int    // sent back
+		rawQuery string // forwarded, "-" when not forwarded at all
+	}{
+		{"valid", false, "/x?b=x%20y&a=1", `{"id":"1"}`, 200, `{"id":"1"}`, 200, "b=x%20y&a=1"},
+		{"no query", true, "/x", `{"id":"1"}`, 200, `{"id":"1"}`, 200, ""},
+		{"client param dropped", false, "/x?client=other&a=1&cl%69ent=other", `{"id":"1"}`, 200, `{"id":"1"}`, 200, "a=1"},
+		{"invalid request", false, "/x", `{"id":1}`, 200, `{"id":"1"}`, 200, ""},
+		{"strict invalid request", true, "/x?a=1", `{"id":1}`, 200, `{"id":"1"}`, 422, "-"},
+		{"invalid response", false, "/x", `{"id":"1"}`, 200, `{}`, 200, ""},
+		{"strict invalid response", true, "/x", `{"id":"1"}`, 200, `{}`, 502, ""},
+		{"strict failed answer", true, "/x", `{"id":"1"}`, 404, `{}`, 404, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := newUpstreamHandler(server.URL, req, res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u.strict = test.strict
+			*backend = testUpstream{status: test.status, answer: test.answer}
+
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, httptest.NewRequest("POST", test.target, bytes.NewBufferString(test.body)), "", false)
+			if w.Code != test.code {
+				t.Errorf("answered %d, want %d", w.Code, test.code)
+			}
+			if test.rawQuery == "-" {
+				if backend.calls > 0 {
+					t.Error("forwarded anyway")
+				}
+				return
+			}
+			if backend.calls != 1 || backend.method != "POST" || backend.rawQuery != test.rawQuery || backend.body != test.body {
+				t.Errorf("upstream got %d calls %s ?%s %s, want ?%s %s", backend.calls, backend.method, backend.rawQuery, backend.body, test.rawQuery, test.body)
+			}
+			if w.Code == test.status && w.Body.String() != test.answer {
+				t.Errorf("answer %s, want %s", w.Body.String(), test.answer)
+			}
+		})
+	}
+}
+
+func TestUpstreamUnreachable(t *testing.T) {
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	_, req, res := writeTestSchemas(t)
+	u, err := newUpstreamHandler(url, req, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	u.ServeHTTP(w, httptest.NewRequest("POST", "/x", bytes.NewBufferString(`{"id":"1"}`)), "", false)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("answered %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
+
+func TestWithoutQueryParam(t *testing.T) {
+	tests := []struct {
+		rawQuery string
+		name     string
+		kept     string
+	}{
+		{"a=1&client=x&b=%20", "client", "a=1&b=%20"},
+		{"client&client=y", "client", ""},
+		{"a=1", "", "a=1"},
+		{"clients=1&client2=2", "client", "clients=1&client2=2"},
+	}
+	for _, test := range tests {
+		if kept := withoutQueryParam(test.rawQuery, test.name); kept != test.kept {
+			t.Errorf("%s without %s: %s, want %s", test.rawQuery, test.name, kept, test.kept)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RecordUpstream real backend to be recorded, empty means no record mode
+var RecordUpstream = ""
+
+// RecordMockFile where recorded entries are appended by default; its extension decides its format
+var RecordMockFile = "recordedMap.jsonl"
+
+// serves a real backend recording its answers: JsonMock record -upstream=... -recordMap=...
+func recordCommand(args []string) int {
+
+	config := defaultConfig()
+	flags := serverFlags("record", config)
+	flags.StringVar(&RecordUpstream, "upstream", RecordUpstream, "Real backend URL to forward every request to, recording its answers. Same as -record.")
+	if err := loadConfig(flags, config, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(RecordUpstream) == 0 {
+		flags.Usage()
+		return 2
+	}
+	return runServer(config)
+}
+
+// keeps every answer of the real backend as a new fixture
+type recorder struct {
+	file     string
+	mutex    sync.Mutex
+	keys     map[string]bool
+	recorded uint64
+}
+
+// recorder appending to a mapping file, knowing the keys already recorded there by previous runs
+func newRecorder(file string) (*recorder, error) {
+
+	rec := &recorder{file: file, keys: make(map[string]bool)}
+	if info, err := os.Stat(file); err != nil || info.Size() == 0 {
+		return rec, nil
+	}
+	err := forEachMockEntry(file, nil, func(query string, request string, response string) {
+		if compacted, err := compactObject([]byte(request)); err == nil {
+			rec.keys[mapKey(query, compacted)] = true
+		}
+	})
+	if err != nil {
+		return nil, errors.New("Unable to record into " + file + ": " + err.Error())
+	}
+	return rec, nil
+}
+
+// append a compacted pair, just once per key
+func (rec *recorder) record(query string, request string, response string, debug bool) {
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	key := mapKey(query, request)
+	if rec.keys[key] {
+		if debug {
+			log.Println("Record: already recorded " + key)
+		}
+		return
+	}
+
+	entry, err := marshalMockEntry(query, request, response)
+	if err == nil {
+		err = appendMockEntry(rec.file, entry)
+	}
+	if err != nil {
+		log.Println("Record: unable to append to " + rec.file + ": " + err.Error())
+		return
+	}
+	rec.keys[key] = true
+	rec.recorded++
+	log.Printf("Record: %d entries appended to %s\n", rec.recorded, rec.file)
+}
+
+// one entry as it is written at any mapping file
+func marshalMockEntry(query string, request string, response string) ([]byte, error) {
+	req := json.RawMessage(request)
+	res := json.RawMessage(response)
+	return marshalAsWritten(ReqResEntry{Qry: query, Req: &req, Res: &res})
+}
+
+// append an entry keeping the format of the file: json lines, yaml sequence or json array
+func appendMockEntry(file string, entry []byte) error {
+
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jsonl", ".ndjson":
+		_, err = f.Write(append(entry, '\n'))
+		return err
+	case ".yaml", ".yml":
+		// json is yaml as well
+		_, err = f.Write(append(append([]byte("- "), entry...), '\n'))
+		return err
+	}
+
+	// json array: overwrite its closing bracket
+	if size == 0 {
+		_, err = f.Write([]byte("[\n" + string(entry) + "\n]\n"))
+		return err
+	}
+	tail := int64(4096)
+	if tail > size {
+		tail = size
+	}
+	last := make([]byte, tail)
+	if _, err := f.ReadAt(last, size-tail); err != nil {
+		return err
+	}
+	bracket := bytes.LastIndexByte(last, ']')
+	if bracket < 0 {
+		return errors.New("closing bracket not found at " + file)
+	}
+	// right after the last entry, or the opening bracket when empty
+	before := bytes.TrimRight(last[:bracket], " \t\r\n")
+	separator := ",\n"
+	if len(before) > 0 && before[len(before)-1] == '[' {
+		separator = "\n"
+	}
+	at := size - tail + int64(len(before))
+	if err := f.Truncate(at); err != nil {
+		return err
+	}
+	_, err = f.WriteAt([]byte(separator+string(entry)+"\n]\n"), at)
+	return err
+}
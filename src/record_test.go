@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorderSeedsKeys(t *testing.T) {
+
+	tests := []struct {
+		file     string
+		previous string
+	}{
+		{"recorded.jsonl", `{"query":"a=1","req":{"id":"1"},"res":{"id":"1"}}` + "\n"},
+		{"recorded.json", "[\n{\"query\":\"a=1\",\"req\":{ \"id\": \"1\" },\"res\":{\"id\":\"1\"}}\n]\n"},
+		{"recorded.yaml", "- query: a=1\n  req: {id: \"1\"}\n  res: {id: \"1\"}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			file := writeTestFile(t, test.file, test.previous)
+
+			rec, err := newRecorder(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// already there from a previous run, then a new one twice
+			rec.record("a=1", `{"id":"1"}`, `{"id":"1"}`, false)
+			rec.record("a=2", `{"id":"1"}`, `{"id":"2"}`, false)
+			rec.record("a=2", `{"id":"1"}`, `{"id":"2"}`, false)
+			if rec.recorded != 1 {
+				t.Errorf("%d entries recorded, want 1", rec.recorded)
+			}
+
+			entries := 0
+			if err := forEachMockEntry(file, nil, func(string, string, string) { entries++ }); err != nil {
+				t.Fatal(err)
+			}
+			if entries != 2 {
+				t.Errorf("%d entries at %s, want 2", entries, file)
+			}
+		})
+	}
+}
+
+func TestRecorderBrokenFile(t *testing.T) {
+	if _, err := newRecorder(writeTestFile(t, "recorded.json", `[{"req":`)); err == nil {
+		t.Error("a broken record file must be refused")
+	}
+	if _, err := newRecorder(filepath.Join(t.TempDir(), "new.jsonl")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecordSkipsInvalidExchanges(t *testing.T) {
+
+	_, req, res := writeTestSchemas(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if bytes.Contains(body, []byte(`"bad"`)) {
+			w.Write([]byte(`{"other":1}`))
+		} else {
+			w.Write(body)
+		}
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name     string
+		request  string
+		recorded bool
+	}{
+		{"valid", `{"id":"1"}`, true},
+		{"invalid request", `{"test":1}`, false},
+		{"invalid response", `{"id":"bad"}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "recorded.jsonl")
+			upstream, err := newUpstreamHandler(backend.URL, req, res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if upstream.recorder, err = newRecorder(file); err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			upstream.forward(w, httptest.NewRequest("POST", "/", nil), "", []byte(test.request), false)
+			if w.Code != http.StatusOK {
+				t.Errorf("status %d, the client is answered anyway", w.Code)
+			}
+			_, err = os.Stat(file)
+			if recorded := err == nil; recorded != test.recorded {
+				t.Errorf("recorded %t, want %t", recorded, test.recorded)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// drafts newer than the validator ones; validated as draft-07 plus whatever they share with it
+var newerSchemaDrafts = []string{"2019-09", "2020-12"}
+
+// keywords of those newer drafts that are not enforced
+var newerSchemaKeywords = []string{"$anchor", "$dynamicAnchor", "$dynamicRef", "$recursiveAnchor", "$recursiveRef",
+	"dependentRequired", "dependentSchemas", "maxContains", "minContains", "prefixItems", "unevaluatedItems", "unevaluatedProperties"}
+
+// ISO 8601 durations as 2019-09 defines them
+var durationRegexp = regexp.MustCompile(`^P(\d+W|(\d+Y)?(\d+M)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?)$`)
+
+type durationFormatChecker struct{}
+
+func (f durationFormatChecker) IsFormat(input interface{}) bool {
+	text, ok := input.(string)
+	if !ok {
+		return true
+	}
+	return durationRegexp.MatchString(text) && !strings.HasSuffix(text, "T") && text != "P"
+}
+
+// every entry of the mapping files on its own, so they are validated while read
+var mockEntrySchema = mustCompileSchema(itemsSchema(MockJsonSchema))
+
+func itemsSchema(schema string) string {
+	var array map[string]interface{}
+	if err := json.Unmarshal([]byte(schema), &array); err != nil {
+		log.Fatal(err)
+	}
+	items, _ := array["items"].(map[string]interface{})
+	items["$schema"] = array["$schema"]
+	data, err := json.Marshal(items)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(data)
+}
+
+func mustCompileSchema(schema string) *gojsonschema.Schema {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return compiled
+}
+
+// date-time, uuid, email and alike are already asserted by the validator
+func init() {
+	gojsonschema.FormatCheckers.Add("duration", durationFormatChecker{})
+}
+
+// schema file compiled just once, loaded by url so relative $ref are resolved against its folder
+func loadSchemaFile(file string) (*gojsonschema.Schema, error) {
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// first value only, trailing garbage is tolerated by the validator as well
+	var document interface{}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&document); err != nil {
+		return nil, err
+	}
+	warnNewerSchemaDraft(file, document)
+
+	url, err := fileURL(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// wrong references are found now, not at the first request
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader(url))
+	if err != nil {
+		return nil, errors.New(file + ": " + err.Error())
+	}
+	return schema, nil
+}
+
+// absolute file url, as the validator expects it on every OS
+func fileURL(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.ToSlash(abs)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return "file://" + path, nil
+}
+
+// tell which parts of a 2019-09/2020-12 schema won't be checked
+func warnNewerSchemaDraft(file string, document interface{}) {
+	newer, unsupported := newerDraftKeywords(document)
+	if len(newer) == 0 {
+		return
+	}
+	if len(unsupported) > 0 {
+		log.Println(file + ": draft " + newer + " validated as draft-07, not enforced: " + strings.Join(unsupported, ", "))
+	} else {
+		log.Println(file + ": draft " + newer + " validated as draft-07")
+	}
+}
+
+// newer draft a schema declares, if any, and its keywords found there
+func newerDraftKeywords(document interface{}) (string, []string) {
+	object, ok := document.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+	draft, _ := object["$schema"].(string)
+	for _, newer := range newerSchemaDrafts {
+		if !strings.Contains(draft, newer) {
+			continue
+		}
+		found := make(map[string]bool)
+		findSchemaKeywords(document, found)
+		var unsupported []string
+		for keyword := range found {
+			unsupported = append(unsupported, keyword)
+		}
+		sort.Strings(unsupported)
+		return newer, unsupported
+	}
+	return "", nil
+}
+
+func findSchemaKeywords(node interface{}, found map[string]bool) {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			for _, keyword := range newerSchemaKeywords {
+				if key == keyword {
+					found[key] = true
+				}
+			}
+			findSchemaKeywords(child, found)
+		}
+	case []interface{}:
+		for _, child := range value {
+			findSchemaKeywords(child, found)
+		}
+	}
+}
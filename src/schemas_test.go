@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewerDraftKeywords(t *testing.T) {
+	tests := []struct {
+		name        string
+		schema      string
+		draft       string
+		unsupported []string
+	}{
+		{"draft-07", `{"$schema":"http://json-schema.org/draft-07/schema#","unevaluatedProperties":false}`, "", nil},
+		{"no draft", `{"prefixItems":[{"type":"string"}]}`, "", nil},
+		{"not an object", `true`, "", nil},
+		{"2019-09 without newer keywords", `{"$schema":"https://json-schema.org/draft/2019-09/schema","type":"object","$defs":{"a":{"type":"string"}}}`, "2019-09", nil},
+		{"2020-12 nested keywords", `{"$schema":"https://json-schema.org/draft/2020-12/schema","properties":{"l":{"prefixItems":[{"type":"string"}],"items":false}},
+			"allOf":[{"unevaluatedProperties":false},{"dependentRequired":{"a":["b"]}}]}`, "2020-12", []string{"dependentRequired", "prefixItems", "unevaluatedProperties"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var document interface{}
+			if err := json.Unmarshal([]byte(test.schema), &document); err != nil {
+				t.Fatal(err)
+			}
+			draft, unsupported := newerDraftKeywords(document)
+			if draft != test.draft || !reflect.DeepEqual(unsupported, test.unsupported) {
+				t.Errorf("draft %q with %v, want %q with %v", draft, unsupported, test.draft, test.unsupported)
+			}
+		})
+	}
+}
+
+func TestWarnNewerSchemaDraft(t *testing.T) {
+
+	var logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logged)
+
+	tests := []struct {
+		schema  string
+		warning string // empty for none
+	}{
+		{`{"$schema":"http://json-schema.org/draft-07/schema#","type":"object"}`, ""},
+		{`{"$schema":"https://json-schema.org/draft/2019-09/schema","type":"object"}`, "schema.json: draft 2019-09 validated as draft-07\n"},
+		{`{"$schema":"https://json-schema.org/draft/2020-12/schema","prefixItems":[true],"minContains":1}`,
+			"schema.json: draft 2020-12 validated as draft-07, not enforced: minContains, prefixItems\n"},
+	}
+	for _, test := range tests {
+		logged.Reset()
+		file := writeTestFile(t, "schema.json", test.schema)
+		if _, err := loadSchemaFile(file); err != nil {
+			t.Fatal(err)
+		}
+		warning := logged.String()
+		if len(test.warning) == 0 && len(warning) > 0 || len(test.warning) > 0 && !strings.HasSuffix(warning, filepath.Dir(file)+string(filepath.Separator)+test.warning) {
+			t.Errorf("%s warned %q, want %q", test.schema, warning, test.warning)
+		}
+	}
+}
+
+func TestDurationFormat(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		valid bool
+	}{
+		{"P1Y2M3DT4H5M6S", true},
+		{"P3W", true},
+		{"PT0.5S", true},
+		{"P1D", true},
+		{"PT36H", true},
+		{"P", false},
+		{"PT", false},
+		{"P1DT", false},
+		{"1D", false},
+		{"P1W2D", false},
+		{"P1.5D", false},
+		{"PT1S2M", false},
+		{42, true}, // not a string, not its business
+	}
+	for _, test := range tests {
+		if valid := (durationFormatChecker{}).IsFormat(test.value); valid != test.valid {
+			t.Errorf("%v valid %t, want %t", test.value, valid, test.valid)
+		}
+	}
+
+	// through the validator too
+	schema, err := loadSchemaFile(writeTestFile(t, "duration.json", `{"type":"string","format":"duration"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if violations := schemaErrors(schema, `"PT1H"`); len(violations) > 0 {
+		t.Errorf("PT1H: %v", violations)
+	}
+	if violations := schemaErrors(schema, `"1 hour"`); len(violations) == 0 {
+		t.Error("1 hour taken as a duration")
+	}
+}
+
+func TestLoadSchemaFileRelativeRefs(t *testing.T) {
+
+	// the schema is somewhere else than the working folder, with its references next to it
+	dir := filepath.Join(t.TempDir(), "schemas with spaces")
+	if err := os.MkdirAll(filepath.Join(dir, "common"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"request.json":      `{"type":"object","required":["id","owner"],"properties":{"id":{"$ref":"common/types.json#/definitions/id"},"owner":{"$ref":"./common/owner.json"}}}`,
+		"common/types.json": `{"definitions":{"id":{"type":"string","pattern":"^[0-9]+$"}}}`,
+		"common/owner.json": `{"type":"object","required":["name"],"properties":{"name":{"$ref":"types.json#/definitions/id"}}}`,
+		"broken.json":       `{"$ref":"missing.json"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schema, err := loadSchemaFile(filepath.Join(dir, "request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		request string
+		valid   bool
+	}{
+		{`{"id":"1","owner":{"name":"2"}}`, true},
+		{`{"id":"x","owner":{"name":"2"}}`, false},
+		{`{"id":"1","owner":{"name":"y"}}`, false},
+		{`{"id":"1","owner":{}}`, false},
+	}
+	for _, test := range tests {
+		if valid := len(schemaErrors(schema, test.request)) == 0; valid != test.valid {
+			t.Errorf("%s valid %t, want %t", test.request, valid, test.valid)
+		}
+	}
+
+	// wrong references are found when loaded
+	if _, err := loadSchemaFile(filepath.Join(dir, "broken.json")); err == nil {
+		t.Error("missing reference not reported")
+	}
+}
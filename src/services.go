@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ServicesFile json or yaml file of named mock services hosted at once by this process, empty for a single one
+var ServicesFile = ""
+
+// one mock service of the services file; its paths are relative to that file
+type serviceConfig struct {
+	Name    string   `json:"name"`
+	Listen  string   `json:"listen,omitempty"` // own listener, like -listen; empty for the shared one
+	Host    string   `json:"host,omitempty"`   // Host header routed to it
+	Prefix  string   `json:"prefix,omitempty"` // path prefix routed to it, taken out before routing OpenAPI operations
+	Map     []string `json:"map,omitempty"`
+	Req     string   `json:"req,omitempty"`
+	Res     string   `json:"res,omitempty"`
+	Index   string   `json:"index,omitempty"`
+	OpenApi string   `json:"openapi,omitempty"`
+	Diff    string   `json:"diff,omitempty"`
+	Debug   bool     `json:"debug,omitempty"`
+}
+
+type servicesConfig struct {
+	Services []serviceConfig `json:"services"`
+}
+
+// loaded mock service, ready to be routed
+type mockService struct {
+	config  serviceConfig
+	handler *customHandler
+	router  *mux.Router
+}
+
+// every service of the file, loaded with its own fixtures and schemas; -req and -res unless it has its own
+func loadServices(file string, requestJsonSchemaFile string, responseJsonSchemaFile string, forcedDebug bool, recordMockFile string) ([]*mockService, error) {
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Unable to read Services File.")
+	}
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJson(data); err != nil {
+			log.Println(err)
+			return nil, errors.New("Unable to process Services File.")
+		}
+	}
+	var config servicesConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Println(err)
+		return nil, errors.New("Unable to process Services File.")
+	}
+	if len(config.Services) == 0 {
+		return nil, errors.New("Unable to find any service at " + file)
+	}
+	return loadServiceConfigs(file, config.Services, requestJsonSchemaFile, responseJsonSchemaFile, forcedDebug, recordMockFile)
+}
+
+// services listed at file, a services file or the config file
+func loadServiceConfigs(file string, configs []serviceConfig, requestJsonSchemaFile string, responseJsonSchemaFile string, forcedDebug bool, recordMockFile string) ([]*mockService, error) {
+
+	passThrough, err := passThroughFromFlags(recordMockFile)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	routes := make(map[string]string)
+	var services []*mockService
+	for _, service := range configs {
+
+		if len(service.Name) == 0 || strings.ContainsAny(service.Name, "/?#") {
+			return nil, errors.New("Unable to take service name '" + service.Name + "': it must be there, without / ? or #")
+		}
+		if names[service.Name] {
+			return nil, errors.New("Unable to take service " + service.Name + ": defined twice")
+		}
+		names[service.Name] = true
+
+		service.Prefix = strings.TrimSuffix(service.Prefix, "/")
+		if len(service.Prefix) > 0 && !strings.HasPrefix(service.Prefix, "/") {
+			return nil, errors.New("Unable to take prefix " + service.Prefix + " of service " + service.Name + ": it must start with /")
+		}
+		// nobody could tell them apart
+		route := service.Listen + " " + strings.ToLower(service.Host) + " " + service.Prefix
+		if other, ok := routes[route]; ok {
+			return nil, errors.New("Unable to route service " + service.Name + ": same listener, host and prefix as " + other)
+		}
+		routes[route] = service.Name
+
+		for i := range service.Map {
+			service.Map[i] = relativeToFile(file, service.Map[i])
+		}
+		req, res := requestJsonSchemaFile, responseJsonSchemaFile
+		if len(service.Req) > 0 {
+			req = relativeToFile(file, service.Req)
+		}
+		if len(service.Res) > 0 {
+			res = relativeToFile(file, service.Res)
+		}
+		if len(service.Index) > 0 {
+			service.Index = relativeToFile(file, service.Index)
+		}
+		if len(service.OpenApi) > 0 {
+			service.OpenApi = relativeToFile(file, service.OpenApi)
+		}
+		service.Debug = service.Debug || forcedDebug
+
+		loaded, err := loadService(service, req, res, passThrough)
+		if err != nil {
+			return nil, errors.New("Unable to load service " + service.Name + ": " + err.Error())
+		}
+		services = append(services, loaded)
+	}
+	return services, nil
+}
+
+// fixtures, schemas and routes of a single service
+func loadService(config serviceConfig, requestJsonSchemaFile string, responseJsonSchemaFile string, passThrough []*upstreamHandler) (*mockService, error) {
+
+	var reqresmap FixtureStore
+	handler := &customHandler{forcedDebug: config.Debug, passThrough: passThrough}
+	if len(config.Index) > 0 {
+		store, err := openDiskStore(config.Index, IndexCacheEntries)
+		if err != nil {
+			return nil, err
+		}
+		if handler.reqSchema, err = loadSchemaFile(requestJsonSchemaFile); err != nil {
+			return nil, err
+		}
+		reqresmap = store
+		log.Printf("%s: %d fake request/response at %s -cache=%d", config.Name, store.Len(), config.Index, IndexCacheEntries)
+	} else {
+		if len(config.Map) == 0 && len(config.OpenApi) == 0 {
+			return nil, errors.New("either map, index or openapi is needed")
+		}
+		store, reqSchema, err := loadMockRequestResponseFiles(config.Map, requestJsonSchemaFile, responseJsonSchemaFile, config.Debug)
+		if _, broken := err.(*mockFileError); broken || (err != nil && len(config.OpenApi) == 0) {
+			return nil, err
+		} else if err != nil && len(config.Map) > 0 {
+			// fixtures might come from the OpenAPI examples only
+			log.Println(config.Name + ": " + err.Error())
+		}
+		reqresmap = store
+		handler.reqSchema = reqSchema
+		log.Printf("%s: %d fake request/response", config.Name, store.Len())
+	}
+	handler.rrmap = reqresmap
+
+	if len(config.Diff) > 0 {
+		log.Println(config.Name + ": comparing fixtures with " + config.Diff + ", see " + AdminPrefix + "/services/" + config.Name + "/diff")
+		handler.shadow = newShadowDiff(config.Diff)
+	}
+
+	router := mux.NewRouter()
+	handler.cmux = router
+	if err := routeMockService(router, handler, reqresmap, config.OpenApi, config.Debug); err != nil {
+		return nil, err
+	}
+	return &mockService{config: config, handler: handler, router: router}, nil
+}
+
+// a listener per address, the shared one being address; services at the same listener routed by Host header and path prefix
+func serveServices(services []*mockService, address string, tlsConfig *tls.Config) error {
+
+	addresses, routers := serviceRouters(services, address)
+
+	// every listener is opened before serving, so a busy one stops everything at once
+	listeners := make([]net.Listener, len(addresses))
+	for i, at := range addresses {
+		listener, err := listen(at)
+		if err != nil {
+			for _, opened := range listeners[:i] {
+				opened.Close()
+			}
+			return err
+		}
+		listeners[i] = listener
+	}
+
+	failed := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		go func(listener net.Listener, router *mux.Router) {
+			failed <- serve(listener, router, tlsConfig)
+		}(listener, routers[addresses[i]])
+	}
+	return <-failed
+}
+
+// flags every service sets on its own are refused instead of being ignored
+func checkServicesFlags(config *Config) error {
+	var given []string
+	if config.Map.set {
+		given = append(given, "-map")
+	}
+	for _, flag := range []struct{ name, value string }{{"-index", IndexFile}, {"-openapi", OpenApiFile}, {"-diff", DiffUpstream}} {
+		if len(flag.value) > 0 {
+			given = append(given, flag.name)
+		}
+	}
+	if len(given) > 0 {
+		return errors.New("Use either -services or " + strings.Join(given, ", ") + ", not both: every service sets its own map, index, openapi and diff")
+	}
+	return nil
+}
+
+// a router per listener, the shared one being address, in the order they are first needed
+func serviceRouters(services []*mockService, address string) ([]string, map[string]*mux.Router) {
+
+	var addresses []string
+	routers := make(map[string]*mux.Router)
+	for _, service := range routedServices(services) {
+		at := service.config.Listen
+		if len(at) == 0 {
+			at = address
+		}
+		router, ok := routers[at]
+		if !ok {
+			router = mux.NewRouter()
+			// every service can be looked at from any listener
+			router.NewRoute().MatcherFunc(pathPrefixMatcher(AdminPrefix + "/services")).Handler(servicesAdmin(services))
+			routers[at] = router
+			addresses = append(addresses, at)
+		}
+
+		route := router.NewRoute()
+		if len(service.config.Host) > 0 {
+			route = route.Host(service.config.Host)
+		}
+		var handler http.Handler = service.router
+		if len(service.config.Prefix) > 0 {
+			route = route.MatcherFunc(pathPrefixMatcher(service.config.Prefix))
+			handler = stripPathPrefix(service.config.Prefix, handler)
+		}
+		route.Handler(handler)
+		log.Printf("Service %s at %s host=%s prefix=%s -debug=%t", service.config.Name, at, service.config.Host, service.config.Prefix, service.config.Debug)
+	}
+	return addresses, routers
+}
+
+// most specific routes first: Host header ones, then the longest prefixes; the file order otherwise
+func routedServices(services []*mockService) []*mockService {
+	routed := append([]*mockService(nil), services...)
+	sort.SliceStable(routed, func(i, j int) bool {
+		a, b := routed[i].config, routed[j].config
+		if (len(a.Host) > 0) != (len(b.Host) > 0) {
+			return len(a.Host) > 0
+		}
+		return len(a.Prefix) > len(b.Prefix)
+	})
+	return routed
+}
+
+// the prefix itself or anything below it, but not /ordersArchive for /orders
+func pathPrefixMatcher(prefix string) mux.MatcherFunc {
+	return func(r *http.Request, match *mux.RouteMatch) bool {
+		return r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/")
+	}
+}
+
+// path without the prefix of the service, / at least
+func stripPathPrefix(prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stripped := new(http.Request)
+		*stripped = *r
+		stripped.URL = new(url.URL)
+		*stripped.URL = *r.URL
+		stripped.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		stripped.URL.RawPath = ""
+		if len(stripped.URL.Path) == 0 {
+			stripped.URL.Path = "/"
+		}
+		handler.ServeHTTP(w, stripped)
+	})
+}
+
+// GET AdminPrefix/services lists them, AdminPrefix/services/<name> tells about one and AdminPrefix/services/<name>/diff reports its drifts
+func servicesAdmin(services []*mockService) http.Handler {
+
+	byName := make(map[string]*mockService)
+	for _, service := range services {
+		byName[service.config.Name] = service
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPrefix+"/services"), "/")
+		if len(path) == 0 {
+			var report []serviceStatus
+			for _, service := range services {
+				report = append(report, service.status())
+			}
+			writeAdminJson(w, report)
+			return
+		}
+
+		name, action := path, ""
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			name, action = path[:i], path[i+1:]
+		}
+		service, ok := byName[name]
+		switch {
+		case !ok:
+			http.Error(w, "Unknown service "+name, http.StatusNotFound)
+		case len(action) == 0:
+			writeAdminJson(w, service.status())
+		case action == "diff" && service.handler.shadow != nil:
+			service.handler.shadow.ServeHTTP(w, r)
+		case action == "diff":
+			http.Error(w, "No diff mode at service "+name, http.StatusNotFound)
+		default:
+			http.Error(w, "Unknown admin endpoint "+action+" of service "+name, http.StatusNotFound)
+		}
+	})
+}
+
+// what the admin endpoints tell about a service
+type serviceStatus struct {
+	Name     string   `json:"name"`
+	Listen   string   `json:"listen,omitempty"`
+	Host     string   `json:"host,omitempty"`
+	Prefix   string   `json:"prefix,omitempty"`
+	Map      []string `json:"map,omitempty"`
+	Index    string   `json:"index,omitempty"`
+	OpenApi  string   `json:"openapi,omitempty"`
+	Diff     string   `json:"diff,omitempty"`
+	Debug    bool     `json:"debug"`
+	Fixtures int      `json:"fixtures"`
+}
+
+func (s *mockService) status() serviceStatus {
+	return serviceStatus{
+		Name:     s.config.Name,
+		Listen:   s.config.Listen,
+		Host:     s.config.Host,
+		Prefix:   s.config.Prefix,
+		Map:      s.config.Map,
+		Index:    s.config.Index,
+		OpenApi:  s.config.OpenApi,
+		Diff:     s.config.Diff,
+		Debug:    s.config.Debug,
+		Fixtures: s.handler.rrmap.Len(),
+	}
+}
+
+func writeAdminJson(w http.ResponseWriter, value interface{}) {
+	report, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(report)
+}
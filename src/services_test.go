@@ -0,0 +1,146 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPathPrefixMatcher(t *testing.T) {
+	tests := []struct {
+		path  string
+		match bool
+	}{
+		{"/orders", true},
+		{"/orders/", true},
+		{"/orders/1", true},
+		{"/ordersArchive", false},
+		{"/order", false},
+		{"/", false},
+		{"/other/orders", false},
+	}
+	matcher := pathPrefixMatcher("/orders")
+	for _, test := range tests {
+		if match := matcher(httptest.NewRequest("GET", test.path, nil), nil); match != test.match {
+			t.Errorf("%s matched %t, want %t", test.path, match, test.match)
+		}
+	}
+}
+
+func TestRoutedServices(t *testing.T) {
+	service := func(name string, host string, prefix string) *mockService {
+		return &mockService{config: serviceConfig{Name: name, Host: host, Prefix: prefix}}
+	}
+	services := []*mockService{
+		service("all", "", ""),
+		service("orders", "", "/orders"),
+		service("hosted", "api.example.com", ""),
+		service("items", "", "/orders/items"),
+		service("other", "", ""),
+		service("hostedOrders", "api.example.com", "/orders"),
+	}
+	var names []string
+	for _, routed := range routedServices(services) {
+		names = append(names, routed.config.Name)
+	}
+	if want := []string{"hostedOrders", "hosted", "items", "orders", "all", "other"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("routed %v, want %v", names, want)
+	}
+	if services[0].config.Name != "all" {
+		t.Error("services reordered in place")
+	}
+}
+
+func TestServiceRouters(t *testing.T) {
+
+	// every service answers with its name and the path it was given
+	service := func(name string, listen string, host string, prefix string) *mockService {
+		router := mux.NewRouter()
+		router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name+" "+r.URL.Path)
+		})
+		return &mockService{config: serviceConfig{Name: name, Listen: listen, Host: host, Prefix: prefix}, router: router}
+	}
+	services := []*mockService{
+		service("all", "", "", ""),
+		service("orders", "", "", "/orders"),
+		service("items", "", "", "/orders/items"),
+		service("hosted", "", "api.example.com", ""),
+		service("own", ":7000", "", ""),
+	}
+	addresses, routers := serviceRouters(services, ":9797")
+	if want := []string{":9797", ":7000"}; !reflect.DeepEqual(addresses, want) {
+		t.Fatalf("addresses %v, want %v", addresses, want)
+	}
+
+	tests := []struct {
+		address string
+		host    string
+		path    string
+		answer  string
+	}{
+		{":9797", "", "/pets", "all /pets"},
+		{":9797", "", "/orders", "orders /"},
+		{":9797", "", "/orders/1", "orders /1"},
+		{":9797", "", "/ordersArchive", "all /ordersArchive"},
+		{":9797", "", "/orders/items/2", "items /2"},
+		{":9797", "api.example.com", "/orders/1", "hosted /orders/1"},
+		{":7000", "", "/orders/1", "own /orders/1"},
+		{":7000", "api.example.com", "/", "own /"},
+		{":9797", "", AdminPrefix + "/servicesX", "all " + AdminPrefix + "/servicesX"},
+		{":7000", "", AdminPrefix + "/services-old", "own " + AdminPrefix + "/services-old"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", test.path, nil)
+		if len(test.host) > 0 {
+			request.Host = test.host
+		}
+		recorder := httptest.NewRecorder()
+		routers[test.address].ServeHTTP(recorder, request)
+		if answer := recorder.Body.String(); answer != test.answer {
+			t.Errorf("%s %s%s answered %q, want %q", test.address, test.host, test.path, answer, test.answer)
+		}
+	}
+
+	// the services admin is at every listener, before any service
+	for _, address := range addresses {
+		recorder := httptest.NewRecorder()
+		routers[address].ServeHTTP(recorder, httptest.NewRequest("GET", AdminPrefix+"/services/none", nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s services admin answered %d %s", address, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestCheckServicesFlags(t *testing.T) {
+
+	defer func(index string, openApi string, diff string) {
+		IndexFile, OpenApiFile, DiffUpstream = index, openApi, diff
+	}(IndexFile, OpenApiFile, DiffUpstream)
+
+	tests := []struct {
+		name string
+		args []string
+		err  string // empty for none
+	}{
+		{"none", nil, ""},
+		{"schemas", []string{"-req=r.json", "-res=s.json"}, ""},
+		{"map", []string{"-map=a.json"}, "Use either -services or -map, not both: every service sets its own map, index, openapi and diff"},
+		{"several", []string{"-index=a.idx", "-openapi=api.yaml", "-diff=http://api"}, "Use either -services or -index, -openapi, -diff, not both: every service sets its own map, index, openapi and diff"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			IndexFile, OpenApiFile, DiffUpstream = "", "", ""
+			config := defaultConfig()
+			serverFlags("serve", config).Parse(test.args)
+			err := checkServicesFlags(config)
+			if (err == nil && len(test.err) > 0) || (err != nil && err.Error() != test.err) {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
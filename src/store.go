@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+)
+
+// fixture answer, as it was loaded
+type QueryResponse struct {
+	query    string
+	response string
+}
+
+// FixtureStore where fixtures are looked up while serving: in memory by default, or on disk with -index
+type FixtureStore interface {
+	Len() int
+	lookup(query string, request []byte) *fixtureEntry
+}
+
+// several stores looked up in order, the first one wins
+type storeChain []FixtureStore
+
+func (c storeChain) Len() int {
+	total := 0
+	for _, store := range c {
+		total += store.Len()
+	}
+	return total
+}
+
+func (c storeChain) lookup(query string, request []byte) *fixtureEntry {
+	for _, store := range c {
+		if entry := store.lookup(query, request); entry != nil {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Request Response map: fixtures indexed by the 64-bit hash of their key, collisions chained and verified
+type RequestResponseMap struct {
+	index   map[uint64]uint32 // first entry with that hash, plus one
+	entries []fixtureEntry
+}
+
+// answer ready to be written: bytes and headers already serialized
+type fixtureEntry struct {
+	key      string
+	query    string // slice of key, no extra memory
+	response []byte
+	length   []string
+	encoded  []encodedResponse // compressed variants, in order of preference
+	next     uint32            // next entry with the same hash, plus one; 0 at the end of the chain
+}
+
+// every answer is json
+var jsonContentType = []string{"application/json"}
+
+// FNV-1a, 64 bits
+const (
+	hashOffset uint64 = 14695981039346656037
+	hashPrime  uint64 = 1099511628211
+)
+
+func hashString(hash uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= hashPrime
+	}
+	return hash
+}
+
+func hashBytes(hash uint64, b []byte) uint64 {
+	for _, c := range b {
+		hash ^= uint64(c)
+		hash *= hashPrime
+	}
+	return hash
+}
+
+// same hash as hashString(hashOffset, mapKey(query, request)), without building the key
+func hashKey(query string, request []byte) uint64 {
+	hash := hashOffset
+	if len(query) > 0 {
+		hash = hashString(hash, "[")
+		hash = hashString(hash, query)
+		hash = hashString(hash, "]")
+	}
+	return hashBytes(hash, request)
+}
+
+// same as key == mapKey(query, string(request)), without building the key
+func sameKey(key string, query string, request []byte) bool {
+	if len(query) == 0 {
+		return key == string(request)
+	}
+	return len(key) == len(query)+2+len(request) && key[0] == '[' && key[1:1+len(query)] == query &&
+		key[1+len(query)] == ']' && key[2+len(query):] == string(request)
+}
+
+// room for size fixtures beforehand, to avoid growing while loading
+func newRequestResponseMap(size int) *RequestResponseMap {
+	return &RequestResponseMap{index: make(map[uint64]uint32, size), entries: make([]fixtureEntry, 0, size)}
+}
+
+func (m *RequestResponseMap) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.entries)
+}
+
+// add a fixture unless its key is already there; first one wins
+func (m *RequestResponseMap) Add(key string, value QueryResponse) bool {
+	if m.index == nil {
+		m.index = make(map[uint64]uint32)
+	}
+	hash := hashString(hashOffset, key)
+	head := m.index[hash]
+	for at := head; at > 0; at = m.entries[at-1].next {
+		if m.entries[at-1].key == key {
+			return false
+		}
+	}
+	query := ""
+	if len(value.query) > 0 {
+		query = key[1 : 1+len(value.query)]
+	}
+	m.entries = append(m.entries, fixtureEntry{
+		key:      key,
+		query:    query,
+		response: []byte(value.response),
+		length:   []string{strconv.Itoa(len(value.response))},
+		next:     head,
+	})
+	compressEntry(&m.entries[len(m.entries)-1])
+	m.index[hash] = uint32(len(m.entries))
+	return true
+}
+
+// take the fixtures of another map, already serialized, unless their keys are already there
+func (m *RequestResponseMap) merge(other *RequestResponseMap, duplicated func(key string)) int {
+	if m.index == nil {
+		m.index = make(map[uint64]uint32)
+	}
+	merged := 0
+	for i := range other.entries {
+		entry := other.entries[i]
+		hash := hashString(hashOffset, entry.key)
+		head := m.index[hash]
+		found := false
+		for at := head; at > 0 && !found; at = m.entries[at-1].next {
+			found = m.entries[at-1].key == entry.key
+		}
+		if found {
+			duplicated(entry.key)
+			continue
+		}
+		entry.next = head
+		m.entries = append(m.entries, entry)
+		m.index[hash] = uint32(len(m.entries))
+		merged++
+	}
+	return merged
+}
+
+// fixture of a key, if any
+func (m *RequestResponseMap) Get(key string) (QueryResponse, bool) {
+	if entry := m.lookup("", []byte(key)); entry != nil {
+		return QueryResponse{query: entry.query, response: string(entry.response)}, true
+	}
+	return QueryResponse{}, false
+}
+
+// every fixture, in the order they were added
+func (m *RequestResponseMap) Range(f func(key string, value QueryResponse)) {
+	if m == nil {
+		return
+	}
+	for i := range m.entries {
+		f(m.entries[i].key, QueryResponse{query: m.entries[i].query, response: string(m.entries[i].response)})
+	}
+}
+
+// request path look up: no key built, no allocation
+func (m *RequestResponseMap) lookup(query string, request []byte) *fixtureEntry {
+	if m == nil || len(m.entries) == 0 {
+		return nil
+	}
+	for at := m.index[hashKey(query, request)]; at > 0; at = m.entries[at-1].next {
+		if sameKey(m.entries[at-1].key, query, request) {
+			return &m.entries[at-1]
+		}
+	}
+	return nil
+}
+
+// reused buffers for bodies and their compacted form
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	return buffer
+}
+
+func putBuffer(buffer *bytes.Buffer) {
+	// huge bodies are not kept forever
+	if buffer.Cap() <= 64*1024 {
+		bufferPool.Put(buffer)
+	}
+}
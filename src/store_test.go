@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashKey(t *testing.T) {
+	tests := []struct {
+		query   string
+		request string
+	}{
+		{"", `{"id":"1"}`},
+		{"a=1&b=2", `{"id":"1"}`},
+		{"a=1", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got, want := hashKey(test.query, []byte(test.request)), hashString(hashOffset, mapKey(test.query, test.request)); got != want {
+			t.Errorf("hashKey(%q, %s) = %x, want %x", test.query, test.request, got, want)
+		}
+	}
+}
+
+func TestSameKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		query   string
+		request string
+		same    bool
+	}{
+		{`{"id":"1"}`, "", `{"id":"1"}`, true},
+		{`[a=1]{"id":"1"}`, "a=1", `{"id":"1"}`, true},
+		{`[a=1]`, "a=1", ``, true},
+		{`[a=1]{"id":"1"}`, "", `{"id":"1"}`, false},
+		{`{"id":"1"}`, "a=1", `{"id":"1"}`, false},
+		{`[a=1]{"id":"1"}`, "a=2", `{"id":"1"}`, false},
+		{`[a=1]{"id":"1"}`, "a=1", `{"id":"2"}`, false},
+		{`[a=1]{"id":"1"}`, "a=1]{", `"id":"1"}`, false},
+		{`[a=1]{"id":"1"}`, "a", `=1]{"id":"1"}`, false},
+		{`[a=1]x{"id":"1"}`, "a=1", `{"id":"1"}`, false},
+		{`{"id":"1"}x`, "", `{"id":"1"}`, false},
+	}
+	for _, test := range tests {
+		if got := sameKey(test.key, test.query, []byte(test.request)); got != test.same {
+			t.Errorf("sameKey(%s, %q, %s) = %t", test.key, test.query, test.request, got)
+		}
+	}
+}
+
+// every key of the map, and the extra ones, sharing a single chain as if all their hashes collided
+func collideKeys(m *RequestResponseMap, extra ...string) {
+	for i := range m.entries {
+		m.entries[i].next = uint32(i)
+	}
+	head := uint32(len(m.entries))
+	for i := range m.entries {
+		m.index[hashString(hashOffset, m.entries[i].key)] = head
+	}
+	for _, key := range extra {
+		m.index[hashString(hashOffset, key)] = head
+	}
+}
+
+func TestCollisionChains(t *testing.T) {
+
+	keys := []string{`{"id":"1"}`, `[a=1]{"id":"1"}`, `[a=1]{"id":"2"}`, `[b=2]`}
+	m := newRequestResponseMap(0)
+	for i, key := range keys {
+		query := ""
+		if key[0] == '[' {
+			query = key[1:4]
+		}
+		m.Add(key, QueryResponse{query: query, response: `{"n":` + strconv.Itoa(i) + `}`})
+	}
+	collideKeys(m, `[a=1]{"id":"3"}`, `{"id":"4"}`)
+
+	tests := []struct {
+		query    string
+		request  string
+		response string // empty when not found
+	}{
+		{"", `{"id":"1"}`, `{"n":0}`},
+		{"a=1", `{"id":"1"}`, `{"n":1}`},
+		{"a=1", `{"id":"2"}`, `{"n":2}`},
+		{"b=2", ``, `{"n":3}`},
+		{"a=1", `{"id":"3"}`, ``},
+		{"", `{"id":"4"}`, ``},
+	}
+	for _, test := range tests {
+		entry := m.lookup(test.query, []byte(test.request))
+		switch {
+		case entry == nil && len(test.response) > 0:
+			t.Errorf("[%s]%s not found along the chain", test.query, test.request)
+		case entry != nil && string(entry.response) != test.response:
+			t.Errorf("[%s]%s found %s, want %s", test.query, test.request, entry.response, test.response)
+		case entry != nil && entry.query != test.query:
+			t.Errorf("[%s]%s found with query %s", test.query, test.request, entry.query)
+		}
+	}
+
+	// duplicated keys are still found along the chain, new ones join its head
+	if m.Add(`[a=1]{"id":"1"}`, QueryResponse{query: "a=1", response: `{}`}) {
+		t.Error("duplicated key added")
+	}
+	if !m.Add(`[a=1]{"id":"3"}`, QueryResponse{query: "a=1", response: `{"n":4}`}) {
+		t.Error("new key not added")
+	}
+	if entry := m.lookup("a=1", []byte(`{"id":"3"}`)); entry == nil || string(entry.response) != `{"n":4}` || entry.next != uint32(len(keys)) {
+		t.Errorf("new key at the chain head: %+v", entry)
+	}
+	if entry := m.lookup("", []byte(`{"id":"1"}`)); entry == nil || string(entry.response) != `{"n":0}` {
+		t.Error("chain tail lost")
+	}
+
+	// merged maps follow the chains of the target one
+	other := newRequestResponseMap(0)
+	other.Add(`{"id":"1"}`, QueryResponse{response: `{"other":1}`})
+	other.Add(`{"id":"4"}`, QueryResponse{response: `{"other":4}`})
+	var duplicated []string
+	if merged := m.merge(other, func(key string) { duplicated = append(duplicated, key) }); merged != 1 || len(duplicated) != 1 || duplicated[0] != `{"id":"1"}` {
+		t.Errorf("%d merged, duplicated %v", merged, duplicated)
+	}
+	if entry := m.lookup("", []byte(`{"id":"4"}`)); entry == nil || string(entry.response) != `{"other":4}` {
+		t.Error("merged key not found")
+	}
+	if entry := m.lookup("", []byte(`{"id":"1"}`)); entry == nil || string(entry.response) != `{"n":0}` {
+		t.Error("first definition must win")
+	}
+	if m.Len() != len(keys)+2 {
+		t.Errorf("%d fixtures", m.Len())
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadProgressEntries entries loaded between progress logs, 0 for none
+var LoadProgressEntries = 100000
+
+// a single json line can't be bigger than that
+const maxMockEntrySize = 64 * 1024 * 1024
+
+// entries of a mapping file read one by one, so huge files are loaded within bounded memory
+type mockEntryReader struct {
+	closer  io.Closer
+	read    *countingReader
+	size    int64
+	dec     *json.Decoder  // json array, yaml converted
+	scanner *bufio.Scanner // json lines
+	line    int
+}
+
+// bytes read so far, for the progress logs
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// open a mapping file of any supported format, positioned at its first entry
+func openMockEntries(mockRequestResponseFile string) (*mockEntryReader, error) {
+
+	file, err := os.Open(mockRequestResponseFile)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	reader, err := newMockEntryReader(file, filepath.Ext(mockRequestResponseFile), size)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// entries of any reader, its format told by the extension; size is only for the progress logs, 0 when unknown
+func newMockEntryReader(input io.Reader, extension string, size int64) (*mockEntryReader, error) {
+
+	reader := &mockEntryReader{read: &countingReader{reader: input}, size: size}
+
+	switch strings.ToLower(extension) {
+	case ".yaml", ".yml":
+		// a yaml sequence can't be split before being parsed, so it is converted as a whole
+		data, err := ioutil.ReadAll(reader.read)
+		if err != nil {
+			return nil, err
+		}
+		array, _, err := yamlToJsonArray(data)
+		if err != nil {
+			return nil, err
+		}
+		reader.dec = json.NewDecoder(bytes.NewReader(array))
+	case ".jsonl", ".ndjson":
+		reader.scanner = bufio.NewScanner(reader.read)
+		reader.scanner.Buffer(make([]byte, 64*1024), maxMockEntrySize)
+		return reader, nil
+	default:
+		reader.dec = json.NewDecoder(bufio.NewReaderSize(reader.read, 64*1024))
+	}
+
+	token, err := reader.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("expected a json array at Mock Request Response File")
+	}
+	return reader, nil
+}
+
+// next entry as it is written, io.EOF after the last one
+func (r *mockEntryReader) next() (json.RawMessage, error) {
+
+	var raw json.RawMessage
+	if r.scanner != nil {
+		for r.scanner.Scan() {
+			r.line++
+			entry := bytes.TrimSpace(r.scanner.Bytes())
+			if len(entry) == 0 {
+				continue
+			}
+			if err := json.Unmarshal(entry, &raw); err != nil {
+				return nil, fmt.Errorf("line %d: %v", r.line, err)
+			}
+			return raw, nil
+		}
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	if !r.dec.More() {
+		// closing bracket
+		if _, err := r.dec.Token(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	if err := r.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// how far it went, in MB
+func (r *mockEntryReader) progress() string {
+	if r.size > 0 {
+		return fmt.Sprintf("%d of %d MB read", r.read.count>>20, r.size>>20)
+	}
+	return fmt.Sprintf("%d MB read", r.read.count>>20)
+}
+
+func (r *mockEntryReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
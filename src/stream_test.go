@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// file of a test, at its own temporary folder
+func writeTestFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestForEachMockEntryHeader(t *testing.T) {
+
+	withHeader := `[{"schemas":{"req":"req.json"}},{"req":{"a":1},"res":{"b":"x"}}]`
+	withoutHeader := `[{"query":"q=1","req":{"a":1},"res":{"b":"x"}}]`
+
+	tests := []struct {
+		name     string
+		content  string
+		callback bool
+		schemas  *MockSchemas
+		entries  []string
+	}{
+		{"header, nil callback", withHeader, false, nil, []string{`|{"a":1}|{"b":"x"}`}},
+		{"header, callback", withHeader, true, &MockSchemas{Req: "req.json"}, []string{`|{"a":1}|{"b":"x"}`}},
+		{"no header, nil callback", withoutHeader, false, nil, []string{`q=1|{"a":1}|{"b":"x"}`}},
+		{"no header, callback", withoutHeader, true, nil, []string{`q=1|{"a":1}|{"b":"x"}`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeTestFile(t, "map.json", test.content)
+
+			var header func(schemas *MockSchemas) error
+			called := 0
+			var schemas *MockSchemas
+			if test.callback {
+				header = func(s *MockSchemas) error {
+					called++
+					schemas = s
+					return nil
+				}
+			}
+			var entries []string
+			err := forEachMockEntry(file, header, func(query string, request string, response string) {
+				entries = append(entries, query+"|"+request+"|"+response)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, test.entries) {
+				t.Errorf("entries %v, want %v", entries, test.entries)
+			}
+			if test.callback && called != 1 {
+				t.Errorf("header called %d times, want once", called)
+			}
+			if !reflect.DeepEqual(schemas, test.schemas) {
+				t.Errorf("schemas %+v, want %+v", schemas, test.schemas)
+			}
+		})
+	}
+}
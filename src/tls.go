@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Protocol served: fcgi behind NGINX, plain http so no NGINX is needed, or h2c adding cleartext HTTP/2 to it
+var Protocol = "fcgi"
+
+// TLSCertFile and TLSKeyFile server certificate and its key, PEM encoded; HTTPS implies -protocol=http
+var TLSCertFile = ""
+var TLSKeyFile = ""
+
+// TLSAuto self-signed certificate made up at startup, signed by a CA written to -tls-auto-ca for clients to trust, TLSAutoCAFile by default
+var TLSAuto = false
+var TLSAutoCAFile = "jsonmockCA.pem"
+
+// TLSClientCAFile CA every client certificate must be signed by, empty for no client certificates
+var TLSClientCAFile = ""
+
+// TLSClientParam query parameter taking the Common Name of the client certificate, so fixtures can match it
+var TLSClientParam = ""
+
+// made up certificates are only valid for a while
+var tlsAutoValidity = 365 * 24 * time.Hour
+
+// TLS configuration from the flags, nil for no TLS at all
+func serverTLSConfig(host string, autoCAFile string) (*tls.Config, error) {
+
+	if Protocol != "fcgi" && Protocol != "http" && Protocol != "h2c" {
+		return nil, errors.New("Unable to serve -protocol=" + Protocol + ": either fcgi, http or h2c")
+	}
+	if !TLSAuto && len(TLSCertFile) == 0 && len(TLSKeyFile) == 0 {
+		if len(TLSClientCAFile) > 0 {
+			return nil, errors.New("Unable to verify client certificates without TLS: use -tls-cert and -tls-key, or -tls-auto")
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if TLSAuto {
+		if len(TLSCertFile) > 0 || len(TLSKeyFile) > 0 {
+			return nil, errors.New("Use either -tls-auto or -tls-cert and -tls-key, not both")
+		}
+		certificate, err := autoCertificate(autoCAFile, certificateHosts(host))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	} else {
+		certificate, err := tls.LoadX509KeyPair(TLSCertFile, TLSKeyFile)
+		if err != nil {
+			return nil, errors.New("Unable to read TLS certificate: " + err.Error())
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	// mutual TLS
+	if len(TLSClientCAFile) > 0 {
+		data, err := ioutil.ReadFile(TLSClientCAFile)
+		if err != nil {
+			return nil, errors.New("Unable to read client CA: " + err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("Unable to read client CA: no PEM certificate at " + TLSClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// names a made up certificate is valid for
+func certificateHosts(host string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	if len(host) > 0 && host != "0.0.0.0" && host != "::" {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// server certificate signed by the CA at caFile, made up as well when missing; a client certificate for tests is left next to it
+func autoCertificate(caFile string, hosts []string) (tls.Certificate, error) {
+
+	caKeyFile := strings.TrimSuffix(caFile, ".pem") + "Key.pem"
+	ca, caKey, err := readCA(caFile, caKeyFile)
+	if err != nil {
+		ca, caKey, err = newCA()
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		if err = writePEM(caFile, "CERTIFICATE", ca.Raw); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err = writeKey(caKeyFile, caKey); err != nil {
+			return tls.Certificate{}, err
+		}
+		log.Println("TLS: new CA written to " + caFile + ", make clients trust it")
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0], Organization: []string{"JsonMock"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	certificate, key, err := signCertificate(template, ca, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	// so mutual TLS can be tried straight away
+	client, clientKey, err := signCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "jsonmock-client", Organization: []string{"JsonMock"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	clientFile := strings.TrimSuffix(caFile, "CA.pem")
+	clientFile = strings.TrimSuffix(clientFile, ".pem") + "Client.pem"
+	if err = writePEM(clientFile, "CERTIFICATE", client.Raw); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err = writeKey(strings.TrimSuffix(clientFile, ".pem")+"Key.pem", clientKey); err != nil {
+		return tls.Certificate{}, err
+	}
+	log.Println("TLS: self-signed certificate for " + strings.Join(hosts, ", ") + ", client certificate at " + clientFile)
+
+	return tls.Certificate{Certificate: [][]byte{certificate.Raw, ca.Raw}, PrivateKey: key, Leaf: certificate}, nil
+}
+
+func readCA(caFile string, caKeyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(caFile, caKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !ca.IsCA || time.Now().After(ca.NotAfter) {
+		return nil, nil, errors.New("Unable to reuse CA at " + caFile)
+	}
+	return ca, key, nil
+}
+
+func newCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "JsonMock CA", Organization: []string{"JsonMock"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(tlsAutoValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	return ca, key, err
+}
+
+// leaf certificate with a fresh key, signed by the CA
+func signCertificate(template *x509.Certificate, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serialNumber()
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(tlsAutoValidity)
+	if template.NotAfter.After(ca.NotAfter) {
+		template.NotAfter = ca.NotAfter
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	return certificate, key, err
+}
+
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return serial
+}
+
+func writePEM(file string, kind string, der []byte) error {
+	return ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0644)
+}
+
+// private keys are only readable by their owner
+func writeKey(file string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
+
+// Common Name of the verified client certificate, if any
+func clientCommonName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
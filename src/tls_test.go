@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSClientParam(t *testing.T) {
+
+	defer func(param string) { TLSClientParam = param }(TLSClientParam)
+	TLSClientParam = "client"
+
+	fixtures := newRequestResponseMap(0)
+	fixtures.Add(mapKey("client=alice", `{"id":"1"}`), QueryResponse{query: "client=alice", response: `{"id":"alice"}`})
+	_, req, _ := writeTestSchemas(t)
+	reqSchema, err := loadSchemaFile(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &customHandler{rrmap: fixtures, reqSchema: reqSchema}
+
+	tests := []struct {
+		name   string
+		query  string
+		cn     string // Common Name of the client certificate, none when empty
+		status int
+	}{
+		{"certificate", "", "alice", http.StatusOK},
+		{"spoofed", "?client=alice", "", http.StatusNoContent},
+		{"spoofed over certificate", "?client=alice", "bob", http.StatusNoContent},
+		{"certificate over spoofed", "?client=bob", "alice", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/"+test.query, bytes.NewBufferString(`{"id":"1"}`))
+			if len(test.cn) > 0 {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: test.cn}}}}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d: %s", w.Code, test.status, w.Body.String())
+			}
+		})
+	}
+}
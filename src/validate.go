@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// single problem found at Mock Request Response File
+type ValidationIssue struct {
+	Entry   int    `json:"entry"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Pointer string `json:"pointer,omitempty"`
+	Error   string `json:"error"`
+}
+
+// whole validation report, also used as JSON output
+type ValidationReport struct {
+	File    string            `json:"file"`
+	Entries int               `json:"entries"`
+	Valid   bool              `json:"valid"`
+	Issues  []ValidationIssue `json:"issues"`
+	keys    []entryKey        // map key of every valid entry, to look for duplicates
+	reqFile string            // request schema applied to the entries
+}
+
+// where a map key is defined
+type entryKey struct {
+	key string
+	at  ValidationIssue
+}
+
+// offline check of the fixtures: JsonMock validate -map=... -req=... -res=... -format=human|json
+func validateCommand(args []string) int {
+
+	mockRequestResponseFiles := mapFlag{files: []string{dataFilePath(MockRequestResponseFile)}}
+	requestJsonSchemaFile := dataFilePath(RequestJsonSchemaFile)
+	responseJsonSchemaFile := dataFilePath(ResponseJsonSchemaFile)
+	format := "human"
+
+	flags := commandFlags("validate")
+	flags.Var(&mockRequestResponseFiles, "map", "Fake mapped request/response file, directory or glob. Can be repeated.")
+	flags.StringVar(&requestJsonSchemaFile, "req", requestJsonSchemaFile, "Json Schema to validate requests.")
+	flags.StringVar(&responseJsonSchemaFile, "res", responseJsonSchemaFile, "Json Schema to validate responses.")
+	flags.StringVar(&format, "format", format, "Report format: human or json.")
+	flags.Parse(args)
+
+	if format != "human" && format != "json" {
+		fmt.Fprintln(os.Stderr, "Unknown -format "+format+". Use human or json.")
+		return 2
+	}
+
+	files, err := expandMapFiles(mockRequestResponseFiles.files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	reports := []ValidationReport{}
+	for _, file := range files {
+		reports = append(reports, validateMockFiles(file, requestJsonSchemaFile, responseJsonSchemaFile))
+	}
+	findDuplicatedKeys(reports)
+	checkMockFileSet(reports, requestJsonSchemaFile)
+
+	if format == "json" {
+		out, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, report := range reports {
+			printValidationReport(report)
+		}
+	}
+
+	for _, report := range reports {
+		if !report.Valid {
+			return 1
+		}
+	}
+	return 0
+}
+
+// same key defined twice, in the same file or across files; the loader only keeps the first one
+func findDuplicatedKeys(reports []ValidationReport) {
+	first := make(map[string]string)
+	for r := range reports {
+		for _, key := range reports[r].keys {
+			if previous, ok := first[key.key]; ok {
+				issue := key.at
+				issue.Error = "duplicated key, already defined at " + previous
+				reports[r].Issues = append(reports[r].Issues, issue)
+				reports[r].Valid = false
+				continue
+			}
+			first[key.key] = reports[r].File + " entry " + strconv.Itoa(key.at.Entry)
+		}
+	}
+}
+
+// the loader checks across the files, through the same mockFileSet: every file must bring a valid entry and unknown requests need their request schemas
+func checkMockFileSet(reports []ValidationReport, requestJsonSchemaFile string) {
+	var set mockFileSet
+	for r := range reports {
+		if err := set.loaded(reports[r].reqFile, len(reports[r].keys)); err != nil {
+			reports[r].Issues = append(reports[r].Issues, ValidationIssue{Entry: -1, Error: err.Error()})
+			reports[r].Valid = false
+		}
+	}
+	if _, err := set.requestSchema(requestJsonSchemaFile); err != nil && len(reports) > 0 {
+		reports[0].Issues = append(reports[0].Issues, ValidationIssue{Entry: -1, Error: "Request Json Schema: " + err.Error()})
+		reports[0].Valid = false
+	}
+}
+
+// walk the entries the same way the server loader does, collecting every issue instead of logging them
+func validateMockFiles(mockRequestResponseFile string, requestJsonSchemaFile string, responseJsonSchemaFile string) ValidationReport {
+
+	report := ValidationReport{File: mockRequestResponseFile, Issues: []ValidationIssue{}}
+
+	// schemas are known once the header, if any, has been read
+	var reqSchema, resSchema *gojsonschema.Schema
+	schemasLoaded := false
+	loadSchemas := func(schemas *MockSchemas) {
+		schemasLoaded = true
+		requestFile, responseFile := mockSchemaFiles(mockRequestResponseFile, schemas, requestJsonSchemaFile, responseJsonSchemaFile)
+		report.reqFile = requestFile
+		var err error
+		if reqSchema, err = loadSchemaFile(requestFile); err != nil {
+			report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: "Request Json Schema " + requestFile + ": " + err.Error()})
+		}
+		if resSchema, err = loadSchemaFile(responseFile); err != nil {
+			report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: "Response Json Schema " + responseFile + ": " + err.Error()})
+		}
+	}
+
+	debugRegexp := regexp.MustCompile("^" + DebugParameter + "")
+	err := walkMockEntries(mockRequestResponseFile, func(read *mockEntryRead) error {
+
+		report.Entries++
+		prefix := "/" + strconv.Itoa(read.index)
+		// the loader refuses the whole file then
+		if len(read.invalid) > 0 {
+			for _, desc := range read.invalid {
+				report.Issues = append(report.Issues, ValidationIssue{Entry: read.index, Pointer: prefix + jsonPointer(desc), Error: desc.Description()})
+			}
+			return nil
+		}
+
+		rr := &read.rr
+		if rr.Schemas != nil {
+			if read.index > 0 {
+				report.Issues = append(report.Issues, ValidationIssue{Entry: read.index, Pointer: prefix + "/schemas", Error: "schemas header only allowed as first entry"})
+			} else {
+				loadSchemas(rr.Schemas)
+			}
+			return nil
+		}
+		if !schemasLoaded {
+			loadSchemas(nil)
+		}
+
+		query, request, response, err := mockFixture(rr, debugRegexp)
+		if err != nil {
+			report.Issues = append(report.Issues, ValidationIssue{Entry: read.index, Pointer: prefix, Error: err.Error()})
+			return nil
+		}
+		var issues []ValidationIssue
+		if reqSchema != nil {
+			issues = append(issues, schemaIssues(reqSchema, []byte(request), read.index, prefix+"/req")...)
+		}
+		if resSchema != nil {
+			issues = append(issues, schemaIssues(resSchema, []byte(response), read.index, prefix+"/res")...)
+		}
+		report.Issues = append(report.Issues, issues...)
+
+		// same key the loader would use
+		if len(issues) == 0 && reqSchema != nil && resSchema != nil {
+			report.keys = append(report.keys, entryKey{key: mapKey(query, request), at: ValidationIssue{Entry: read.index, Pointer: prefix}})
+		}
+		return nil
+	})
+	if entryErr, ok := err.(*mockEntryError); ok {
+		report.Issues = append(report.Issues, ValidationIssue{Entry: entryErr.entry, Error: entryErr.Error()})
+	} else if err != nil {
+		report.Issues = append(report.Issues, ValidationIssue{Entry: -1, Error: err.Error()})
+	} else if !schemasLoaded {
+		loadSchemas(nil)
+	}
+
+	if len(report.Issues) > 0 || len(report.keys) > 0 {
+		locateIssues(&report)
+	}
+	report.Valid = len(report.Issues) == 0
+	return report
+}
+
+// line and column of every issue and key at the original file, only read again when there is something to tell
+func locateIssues(report *ValidationReport) {
+
+	mock, positions, err := readMockFile(report.File)
+	if err != nil {
+		return
+	}
+	offsets, _, splitErr := splitMockEntries(mock)
+	locate := func(issue *ValidationIssue) {
+		switch {
+		case issue.Entry >= 0 && issue.Entry < len(offsets):
+			issue.Line, issue.Column = entryPosition(mock, positions, issue.Entry, offsets[issue.Entry])
+		case issue.Entry >= 0 && positions == nil:
+			// where the file can't be read any further
+			offset := int64(len(mock))
+			if syntaxErr, ok := splitErr.(*json.SyntaxError); ok {
+				offset = syntaxErr.Offset
+			}
+			issue.Line, issue.Column = lineColumn(mock, offset)
+		}
+	}
+	for i := range report.Issues {
+		locate(&report.Issues[i])
+	}
+	for i := range report.keys {
+		locate(&report.keys[i].at)
+	}
+}
+
+// decode every entry of the mock array, keeping the offset where it starts
+func splitMockEntries(mock []byte) ([]int64, []ReqResEntry, error) {
+
+	var offsets []int64
+	var entries []ReqResEntry
+
+	dec := json.NewDecoder(bytes.NewReader(mock))
+	token, err := dec.Token()
+	if err != nil {
+		return offsets, entries, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return offsets, entries, fmt.Errorf("expected a json array at Mock Request Response File")
+	}
+
+	for dec.More() {
+		offset := skipSeparators(mock, dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return offsets, entries, err
+		}
+		// wrong types are reported by the mock Json Schema, so just keep what can be read
+		var rr ReqResEntry
+		json.Unmarshal(raw, &rr)
+		offsets = append(offsets, offset)
+		entries = append(entries, rr)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return offsets, entries, err
+	}
+	return offsets, entries, nil
+}
+
+// entry of Mock Request Response File as it is written
+type ReqResEntry struct {
+	Qry     string           `json:"query,omitempty"`
+	Req     *json.RawMessage `json:"req"`
+	Res     *json.RawMessage `json:"res"`
+	Schemas *MockSchemas     `json:"schemas,omitempty"`
+}
+
+// validate one side of an entry and convert its errors into issues
+func schemaIssues(schema *gojsonschema.Schema, doc []byte, entry int, prefix string) []ValidationIssue {
+
+	var issues []ValidationIssue
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		return append(issues, ValidationIssue{Entry: entry, Pointer: prefix, Error: err.Error()})
+	}
+	for _, desc := range result.Errors() {
+		issues = append(issues, ValidationIssue{Entry: entry, Pointer: prefix + jsonPointer(desc), Error: desc.Description()})
+	}
+	return issues
+}
+
+// gojsonschema context (root).0.req into a JSON pointer /0/req
+func jsonPointer(desc gojsonschema.ResultError) string {
+	pointer := strings.TrimPrefix(desc.Context().String("/"), gojsonschema.STRING_CONTEXT_ROOT)
+	// required properties are reported on their parent
+	if property, ok := desc.Details()["property"]; ok && desc.Type() == "required" {
+		pointer += "/" + fmt.Sprint(property)
+	}
+	return pointer
+}
+
+// decoder offset is just after the previous value, so move to the real beginning
+func skipSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// 1-based line and column for a byte offset
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndex(data[:offset], []byte("\n"))
+	return line, column
+}
+
+// line and column of an entry at its original file, which might have been converted into mock
+func entryPosition(mock []byte, positions []filePosition, entry int, offset int64) (int, int) {
+	if positions != nil {
+		if entry < len(positions) {
+			return positions[entry].line, positions[entry].column
+		}
+		return 0, 0
+	}
+	return lineColumn(mock, offset)
+}
+
+// editor friendly output, file:line:column: message
+func printValidationReport(report ValidationReport) {
+	for _, issue := range report.Issues {
+		location := report.File
+		if issue.Line > 0 {
+			location += ":" + strconv.Itoa(issue.Line) + ":" + strconv.Itoa(issue.Column)
+		}
+		if issue.Entry >= 0 && len(issue.Pointer) > 0 {
+			fmt.Printf("%s: entry %d %s: %s\n", location, issue.Entry, issue.Pointer, issue.Error)
+		} else if issue.Entry >= 0 {
+			fmt.Printf("%s: entry %d: %s\n", location, issue.Entry, issue.Error)
+		} else {
+			fmt.Printf("%s: %s\n", location, issue.Error)
+		}
+	}
+	if report.Valid {
+		fmt.Printf("%s: %d entries, all valid\n", report.File, report.Entries)
+	} else {
+		fmt.Printf("%s: %d entries, %d issues\n", report.File, report.Entries, len(report.Issues))
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRequestSchema = `{"type":"object","required":["id"],"properties":{"id":{"type":"string"},"test":{"type":"integer","maximum":1}}}`
+const testResponseSchema = `{"type":"object","required":["id"]}`
+
+// request and response schemas at a folder of their own, returned with that folder
+func writeTestSchemas(t *testing.T) (string, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	req := filepath.Join(dir, "req.json")
+	res := filepath.Join(dir, "res.json")
+	os.WriteFile(req, []byte(testRequestSchema), 0644)
+	os.WriteFile(res, []byte(testResponseSchema), 0644)
+	return dir, req, res
+}
+
+func TestValidateMockFiles(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		issues  []ValidationIssue
+		loaded  int // fixtures the loader keeps, -1 when it refuses the file
+	}{
+		{"valid", "map.json", `[
+{"req":{"id":"1"},"res":{"id":"1"}},
+{"query":"a=1","req":{"id":"1"},"res":{"id":"2"}}
+]`, nil, 2},
+		{"mock schema", "map.json", `[
+{"req":{"id":"1"},"res":{"id":"1"}},
+{"req":{"id":"2"}}
+]`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 1, Pointer: "/1", Error: "Must validate at least one schema (anyOf)"},
+			{Entry: 1, Line: 3, Column: 1, Pointer: "/1/res", Error: "res is required"},
+		}, -1},
+		{"request schema", "map.json", `[
+{"req":{"id":"1"},"res":{"id":"1"}},
+  {"req":{"id":"2","test":5},"res":{"id":"2"}}
+]`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 3, Pointer: "/1/req/test", Error: "Must be less than or equal to 1"},
+		}, 1},
+		{"duplicated key", "map.json", `[
+{"req":{"id":"1"},"res":{"id":"1"}},
+{"req":{ "id" : "1" },"res":{"id":"2"}}
+]`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 1, Pointer: "/1", Error: "duplicated key, already defined at map.json entry 0"},
+		}, 1},
+		{"header schemas", "map.json", `[
+{"schemas":{"res":"strict.json"}},
+{"req":{"id":"1"},"res":{"id":"1"}}
+]`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 1, Pointer: "/1/res/id", Error: "Invalid type. Expected: integer, given: string"},
+			{Entry: -1, Error: "Unable to validate any entry at Mock Request Response File"},
+		}, -1},
+		{"no entries", "map.json", `[{"schemas":{"res":"strict.json"}}]`, []ValidationIssue{
+			{Entry: -1, Error: "Unable to validate any entry at Mock Request Response File"},
+		}, -1},
+		{"misplaced header", "map.json", `[
+{"req":{"id":"1"},"res":{"id":"1"}},
+{"schemas":{"res":"strict.json"}}
+]`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 1, Pointer: "/1/schemas", Error: "schemas header only allowed as first entry"},
+		}, 1},
+		{"syntax", "map.json", `[
+{"req":{"id":"1"},"res":{"id":"1"}},
+{"req":{"id":,}}
+]`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 15, Error: "Unable to process entry 1 at Mock Request Response File: invalid character ',' looking for beginning of value"},
+		}, -1},
+		{"yaml", "map.yaml", `- req: {id: "1"}
+  res: {id: "1"}
+- req: {id: "2", test: 3}
+  res: {id: "2"}
+`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 3, Pointer: "/1/req/test", Error: "Must be less than or equal to 1"},
+		}, 1},
+		{"json lines", "map.jsonl", `{"req":{"id":"1"},"res":{"id":"1"}}
+
+{"req":{"id":"2"},"res":{}}
+`, []ValidationIssue{
+			{Entry: 1, Line: 3, Column: 1, Pointer: "/1/res/id", Error: "id is required"},
+		}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, req, res := writeTestSchemas(t)
+			os.WriteFile(filepath.Join(dir, "strict.json"), []byte(`{"properties":{"id":{"type":"integer"}}}`), 0644)
+			file := filepath.Join(dir, test.file)
+			os.WriteFile(file, []byte(test.content), 0644)
+
+			reports := []ValidationReport{validateMockFiles(file, req, res)}
+			findDuplicatedKeys(reports)
+			checkMockFileSet(reports, req)
+			report := reports[0]
+			issues := report.Issues
+			for i := range issues {
+				issues[i].Error = strings.ReplaceAll(issues[i].Error, dir+string(filepath.Separator), "")
+			}
+			want := test.issues
+			if want == nil {
+				want = []ValidationIssue{}
+			}
+			if !reflect.DeepEqual(issues, want) {
+				t.Errorf("issues\n%+v\nwant\n%+v", issues, want)
+			}
+			if report.Valid != (len(want) == 0) {
+				t.Errorf("valid %t with %d issues", report.Valid, len(want))
+			}
+
+			// the loader takes the very same decisions
+			fixtures, requestSchema, err := validateMockRequestResponseFile(file, req, res, false)
+			if err == nil {
+				var set mockFileSet
+				err = set.loaded(requestSchema, fixtures.Len())
+			}
+			loaded := -1
+			if err == nil {
+				loaded = fixtures.Len()
+			}
+			if loaded != test.loaded {
+				t.Errorf("loader kept %d fixtures (%v), want %d", loaded, err, test.loaded)
+			}
+		})
+	}
+}
+
+func TestValidateMockFilesUnreadable(t *testing.T) {
+	_, req, res := writeTestSchemas(t)
+	report := validateMockFiles(filepath.Join(t.TempDir(), "missing.json"), req, res)
+	if report.Valid || len(report.Issues) != 1 || report.Issues[0].Entry != -1 {
+		t.Errorf("missing file reported as %+v", report)
+	}
+}
+
+func TestValidateMockFileSet(t *testing.T) {
+
+	files := map[string]string{
+		"a.json":     `[{"req":{"id":"1"},"res":{"id":"1"}}]`,
+		"named.json": `[{"schemas":{"req":"name.json"}},{"req":{"name":"n"},"res":{"id":"1"}}]`,
+		"empty.json": `[]`,
+		"none.json":  `[{"req":{"id":1},"res":{"id":"1"}}]`,
+		"name.json":  `{"type":"object","required":["name"]}`,
+	}
+
+	tests := []struct {
+		name  string
+		maps  []string
+		valid bool
+	}{
+		{"different request schemas", []string{"a.json", "named.json"}, true},
+		{"empty file", []string{"a.json", "empty.json"}, false},
+		{"no valid entry", []string{"none.json", "a.json"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, req, res := writeTestSchemas(t)
+			for name, content := range files {
+				os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+			}
+			var maps []string
+			var reports []ValidationReport
+			for _, name := range test.maps {
+				maps = append(maps, filepath.Join(dir, name))
+				reports = append(reports, validateMockFiles(maps[len(maps)-1], req, res))
+			}
+			findDuplicatedKeys(reports)
+			checkMockFileSet(reports, req)
+			valid := true
+			for _, report := range reports {
+				valid = valid && report.Valid
+			}
+			if valid != test.valid {
+				t.Errorf("valid %t, reports %+v", valid, reports)
+			}
+
+			// validate agrees with the loader
+			if _, _, err := loadMockRequestResponseFiles(maps, req, res, false); (err == nil) != valid {
+				t.Errorf("validate says %t, loader %v", valid, err)
+			}
+		})
+	}
+}